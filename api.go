@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// spriteAPI builds sprites from uploaded images. Every request is packed
+// with the options of one of the configured targets, its -src replaced by
+// the upload.
+type spriteAPI struct {
+	targets   []target
+	maxUpload int64
+}
+
+// errUpload marks a request the client has to fix.
+type errUpload struct{ msg string }
+
+func (e errUpload) Error() string { return e.msg }
+
+func uploadErrorf(format string, args ...interface{}) error {
+	return errUpload{fmt.Sprintf(format, args...)}
+}
+
+// errTooLarge marks an upload that unpacks to more than the api accepts.
+type errTooLarge struct{ msg string }
+
+func (e errTooLarge) Error() string { return e.msg }
+
+// maxUnzipRatio bounds what the archives of an upload may unpack to, this
+// many times -max-upload in all, no single file more than -max-upload.
+const maxUnzipRatio = 4
+
+// ServeHTTP answers POST /sprites, taking either multipart/form-data with
+// one part per image (zip archives among them are unpacked) or a single
+// application/zip body, and replying with a zip of every output plus the
+// JSON manifest. ?target=<name> picks a config target, the first one by
+// default.
+func (api *spriteAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/sprites" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, ok := api.target(r.URL.Query().Get("target"))
+	if !ok {
+		http.Error(w, "unknown target", http.StatusNotFound)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "gospritifulcss-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r.Body = http.MaxBytesReader(w, r.Body, api.maxUpload)
+	body, err := api.respond(t, &uploadDir{path: dir, limit: api.maxUpload}, r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var upload errUpload
+		var decode *spritify.DecodeError
+		var options *spritify.OptionsError
+		var tooLarge *http.MaxBytesError
+		var unzipped errTooLarge
+		switch {
+		case errors.As(err, &upload), errors.Is(err, spritify.ErrNoImages), errors.As(err, &decode), errors.As(err, &options):
+			status = http.StatusBadRequest
+		case errors.As(err, &tooLarge), errors.As(err, &unzipped):
+			status = http.StatusRequestEntityTooLarge
+		}
+		logger.Error(fmt.Sprint("api: ", err))
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.opts.Name+".zip"))
+	w.Write(body)
+}
+
+func (api *spriteAPI) target(targetName string) (target, bool) {
+	if targetName == "" {
+		return api.targets[0], true
+	}
+	for _, t := range api.targets {
+		if t.name == targetName {
+			return t, true
+		}
+	}
+	return target{}, false
+}
+
+// respond saves the upload into dir, builds t from it and zips the outputs.
+func (api *spriteAPI) respond(t target, dir *uploadDir, r *http.Request) ([]byte, error) {
+	if err := dir.save(r); err != nil {
+		return nil, err
+	}
+
+	t.opts.Src = dir.path
+	t.opts.Manifest = true
+
+	var files []spritify.File
+	var err error
+	if t.symbols {
+		_, files, err = generateSymbols(t)
+	} else {
+		_, files, err = generate(r.Context(), t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	now := time.Now()
+	for _, f := range files {
+		fw, err := archive.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// uploadDir is the temporary directory a request is saved into.
+type uploadDir struct {
+	path     string
+	limit    int64 // -max-upload
+	unzipped int64 // bytes unpacked from archives so far
+}
+
+func (dir *uploadDir) save(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return uploadErrorf("missing or invalid Content-Type")
+	}
+
+	switch mediaType {
+	case "application/zip":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return dir.unzip(data)
+	case "multipart/form-data":
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return uploadErrorf("%v", err)
+		}
+		return dir.saveParts(reader)
+	}
+	return uploadErrorf("unsupported Content-Type %s, expected multipart/form-data or application/zip", mediaType)
+}
+
+func (dir *uploadDir) saveParts(reader *multipart.Reader) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return uploadErrorf("%v", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(path.Ext(part.FileName()), ".zip") {
+			err = dir.unzip(data)
+		} else {
+			err = dir.saveFile(part.FileName(), data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unzip extracts the files of a zip archive flat into dir, the directories
+// inside it are ignored. It stops at a file larger than -max-upload or once
+// the archives of the request add up to maxUnzipRatio times that.
+func (dir *uploadDir) unzip(data []byte) error {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return uploadErrorf("invalid zip: %v", err)
+	}
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		if entry.UncompressedSize64 > uint64(dir.limit) {
+			return errTooLarge{fmt.Sprintf("%s: unpacks to more than %d bytes", entry.Name, dir.limit)}
+		}
+		if dir.unzipped+int64(entry.UncompressedSize64) > maxUnzipRatio*dir.limit {
+			return errTooLarge{fmt.Sprintf("%s: the archives unpack to more than %d bytes", entry.Name, maxUnzipRatio*dir.limit)}
+		}
+
+		fr, err := entry.Open()
+		if err != nil {
+			return uploadErrorf("%s: %v", entry.Name, err)
+		}
+		// the sizes in the archive are the client's word, so read no more
+		content, err := io.ReadAll(io.LimitReader(fr, int64(entry.UncompressedSize64)+1))
+		fr.Close()
+		if err != nil {
+			return uploadErrorf("%s: %v", entry.Name, err)
+		}
+		if uint64(len(content)) > entry.UncompressedSize64 {
+			return uploadErrorf("%s: larger than the archive says", entry.Name)
+		}
+		dir.unzipped += int64(len(content))
+		if err := dir.saveFile(entry.Name, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveFile writes data to dir under the base name of the client supplied
+// name, so nothing can be written outside dir.
+func (dir *uploadDir) saveFile(clientName string, data []byte) error {
+	filename := path.Base(strings.Replace(clientName, `\`, "/", -1))
+	if filename == "." || filename == "/" || strings.HasPrefix(filename, ".") {
+		return nil
+	}
+
+	pathname := filepath.Join(dir.path, filename)
+	if _, err := os.Stat(pathname); err == nil {
+		return uploadErrorf("%s uploaded twice", filename)
+	}
+	return os.WriteFile(pathname, data, 0666)
+}
+
+// serveAPI runs the sprite API on addr until it fails.
+func serveAPI(targets []target, addr string, maxUpload int64) {
+	logger.Info(fmt.Sprintf("sprite api listening on http://%s/sprites", addr))
+	err := http.ListenAndServe(addr, &spriteAPI{targets: targets, maxUpload: maxUpload})
+	logger.Error(err.Error())
+	os.Exit(-1)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// The cache file remembers what the last successful build of a target read
+// and wrote: a key over the options and every input's content, then one
+// "<sha256> <path>" line per written file. A build whose key matches and
+// whose outputs are all still on disk unchanged is skipped.
+
+func cachePath(t target) string {
+	return filepath.Join(t.out, "."+t.opts.Name+".cache")
+}
+
+func hashFile(pathname string) (string, error) {
+	handler, err := os.Open(pathname)
+	if err != nil {
+		return "", err
+	}
+	defer handler.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, handler); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheKey hashes the settings of t together with the path and content of
+// every file the build would read.
+func cacheKey(t target) (string, error) {
+	g, err := spritify.NewGenerator(t.opts)
+	if err != nil {
+		return "", err
+	}
+
+	var inputs []string
+	if t.symbols {
+		inputs, err = g.SymbolInputs()
+	} else {
+		inputs, err = g.Inputs()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%q %q %q %v %g\n", optionsString(t.opts), t.report, t.postCmd, t.optCmd, t.symbols, t.svgZoom)
+	for _, input := range inputs {
+		sum, err := hashFile(input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, input)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// optionsString renders opts for hashing, with the values behind pointers
+// rather than their addresses.
+func optionsString(opts spritify.Options) string {
+	// the decode pool is a channel and differs on every run, the optimizer
+	// and the svg decoder are closures and hashed through their command
+	// and scale instead, the logger and progress callback do not change
+	// the outputs
+	opts.Decoders = nil
+	opts.Optimize = nil
+	opts.ExtDecoders = nil
+	opts.Logger = nil
+	opts.Progress = nil
+
+	var gap, padding interface{}
+	if opts.Gap != nil {
+		gap = *opts.Gap
+	}
+	if opts.Padding != nil {
+		padding = *opts.Padding
+	}
+	opts.Gap, opts.Padding = nil, nil
+
+	// %v sorts the map and renders the positions through ImageOptions.String
+	images := fmt.Sprintf("%v", opts.Images)
+	opts.Images = nil
+
+	return fmt.Sprintf("%#v gap=%v padding=%v images=%s", opts, gap, padding, images)
+}
+
+// cacheFresh reports whether the cache of t was written for key and every
+// output it lists is still there as it was written.
+func cacheFresh(t target, key string) bool {
+	handler, err := os.Open(cachePath(t))
+	if err != nil {
+		return false
+	}
+	defer handler.Close()
+
+	scanner := bufio.NewScanner(handler)
+	if !scanner.Scan() || scanner.Text() != key {
+		return false
+	}
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			return false
+		}
+		if sum, err := hashFile(fields[1]); err != nil || sum != fields[0] {
+			return false
+		}
+	}
+	return scanner.Err() == nil
+}
+
+// writeCache records key and the files a build wrote.
+func writeCache(t target, key string, written []string) error {
+	var buf strings.Builder
+	buf.WriteString(key + "\n")
+	for _, pathname := range written {
+		sum, err := hashFile(pathname)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "%s %s\n", sum, pathname)
+	}
+	return spritify.WriteFileAtomic(cachePath(t), []byte(buf.String()))
+}
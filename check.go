@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// drift compares freshly generated files with what is on disk under dir,
+// returning one line per file that is missing or different.
+func drift(dir string, files []spritify.File) []string {
+	var lines []string
+	for _, f := range files {
+		pathname := f.Name
+		if !filepath.IsAbs(pathname) {
+			pathname = filepath.Join(dir, f.Name)
+		}
+
+		onDisk, err := os.ReadFile(pathname)
+		switch {
+		case os.IsNotExist(err):
+			lines = append(lines, fmt.Sprintf("%s: missing", pathname))
+		case err != nil:
+			lines = append(lines, fmt.Sprintf("%s: %v", pathname, err))
+		case !bytes.Equal(onDisk, f.Data):
+			lines = append(lines, fmt.Sprintf("%s: %s", pathname, describeDrift(onDisk, f.Data)))
+		}
+	}
+	return lines
+}
+
+// describeDrift says where two versions of a file part, by line for text
+// and by size for binary data.
+func describeDrift(onDisk, generated []byte) string {
+	if bytes.IndexByte(onDisk, 0) >= 0 || bytes.IndexByte(generated, 0) >= 0 {
+		return fmt.Sprintf("differs, %d bytes on disk, %d generated", len(onDisk), len(generated))
+	}
+
+	old := bytes.Split(onDisk, []byte("\n"))
+	cur := bytes.Split(generated, []byte("\n"))
+	for i := 0; i < len(old) && i < len(cur); i++ {
+		if !bytes.Equal(old[i], cur[i]) {
+			return fmt.Sprintf("differs from line %d\n  - %s\n  + %s", i+1, old[i], cur[i])
+		}
+	}
+	return fmt.Sprintf("differs, %d lines on disk, %d generated", len(old), len(cur))
+}
+
+// checkTarget fails when the outputs of t on disk are not what a build
+// would write now. Nothing is written and -post-cmd does not run.
+func checkTarget(t target, files []spritify.File) error {
+	absOut, err := filepath.Abs(t.out)
+	if err != nil {
+		return t.errorf(err)
+	}
+
+	lines := drift(absOut, files)
+	if len(lines) == 0 {
+		return nil
+	}
+	for _, line := range lines {
+		t.log().Error(line)
+	}
+	return t.errorf(fmt.Errorf("%d of %d outputs are out of date, regenerate and commit them", len(lines), len(files)))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// command is one subcommand, run with the arguments after its name.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands = []command{
+	{"generate", "build every target once and write its outputs (the default)", onTargets(runGenerate)},
+	{"watch", "rebuild a target whenever a file in its -src changes", onTargets(runWatch)},
+	{"check", "fail if the outputs on disk differ from a fresh build, writing nothing", onTargets(runCheck)},
+	{"serve", "serve the demo page from memory on -addr and live reload it on changes", onTargets(runServe)},
+	{"api", "answer POST /sprites on -addr with a zip built from the uploaded images", onTargets(runAPI)},
+	{"unpack", "cut a sprite back into images: unpack [-out dir] <sprite> <manifest.json|.css>", runUnpack},
+}
+
+// onTargets adapts a command that runs on the targets described by the
+// shared flags and config files.
+func onTargets(run func(targets []target)) func(args []string) {
+	return func(args []string) {
+		run(parseTargets(args))
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [command] [flags] [url ...]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s%s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(out, "\nflags, except for unpack:")
+	flag.PrintDefaults()
+}
+
+// findCommand splits the command name off args. Without one, args are the
+// flags and urls of generate.
+func findCommand(args []string) (command, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || strings.Contains(args[0], "://") {
+		return commands[0], args
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd, args[1:]
+		}
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n", args[0])
+	usage()
+	os.Exit(2)
+	return command{}, nil
+}
+
+func runGenerate(targets []target) {
+	// -watch predates the watch command and is still honored, also from
+	// config files
+	if *watch {
+		runWatch(targets)
+		return
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = build(targets[i])
+		}(i)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, err := range errs {
+		if err != nil {
+			logger.Error(err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(-1)
+	}
+}
+
+func runWatch(targets []target) {
+	watchSrc(targets, build)
+}
+
+func runCheck(targets []target) {
+	for i := range targets {
+		targets[i].check = true
+	}
+	*watch = false
+	runGenerate(targets)
+}
+
+func runServe(targets []target) {
+	serve(targets, *addr)
+}
+
+func runAPI(targets []target) {
+	serveAPI(targets, *addr, *maxUpload<<20)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+const dirConfigName = ".sprite.toml"
+
+// config is one parsed file. Values outside any table apply to every
+// target, each [targets.<name>] table adds one target in file order and
+// each [images."<file>"] table overrides the options of one source file.
+type config struct {
+	path    string
+	values  map[string]string
+	targets []configTarget
+	images  map[string]spritify.ImageOptions
+}
+
+type configTarget struct {
+	name   string
+	values map[string]string
+}
+
+// parseConfig reads the small TOML subset used by .sprite.toml files: one
+// `key = value` per line where value is a string, integer, boolean or an
+// array of those, optionally grouped under [targets.<name>] or
+// [images."<file>"] headers. Keys are the flag names, e.g. `margin = 2`,
+// or those of imageOptions in image tables.
+func parseConfig(pathname string) (*config, error) {
+	handler, err := os.Open(pathname)
+	if err != nil {
+		return nil, err
+	}
+	defer handler.Close()
+
+	cfg := &config{path: pathname, values: make(map[string]string), images: make(map[string]spritify.ImageOptions)}
+	values := cfg.values
+	imageTables := make(map[string]map[string]string)
+	var imageOrder []string
+	scanner := bufio.NewScanner(handler)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			table, name, err := parseTableHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", pathname, lineNo, err)
+			}
+			if table == "images" {
+				if imageTables[name] != nil {
+					return nil, fmt.Errorf("%s:%d: image %q configured twice", pathname, lineNo, name)
+				}
+				values = make(map[string]string)
+				imageTables[name] = values
+				imageOrder = append(imageOrder, name)
+				continue
+			}
+			for _, t := range cfg.targets {
+				if t.name == name {
+					return nil, fmt.Errorf("%s:%d: target %q defined twice", pathname, lineNo, name)
+				}
+			}
+			values = make(map[string]string)
+			cfg.targets = append(cfg.targets, configTarget{name, values})
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", pathname, lineNo)
+		}
+
+		key := strings.Trim(strings.TrimSpace(line[:eq]), `"`)
+		value, err := parseConfigValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", pathname, lineNo, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range imageOrder {
+		o, err := imageOptions(imageTables[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: images.%q: %v", pathname, name, err)
+		}
+		cfg.images[name] = o
+	}
+	return cfg, nil
+}
+
+// parseTableHeader splits a [targets.<name>] or [images."<file>"] header
+// into the table kind and the name.
+func parseTableHeader(line string) (string, string, error) {
+	// file names may contain a #, so only what follows the header is a comment
+	if end := strings.LastIndex(line, "]"); end >= 0 && strings.HasPrefix(strings.TrimSpace(line[end+1:]), "#") {
+		line = line[:end+1]
+	} else if end < 0 {
+		if hash := strings.Index(line, "#"); hash >= 0 {
+			line = strings.TrimSpace(line[:hash])
+		}
+	}
+	if !strings.HasSuffix(line, "]") {
+		return "", "", fmt.Errorf("unterminated table header %s", line)
+	}
+
+	table := strings.TrimSpace(line[1 : len(line)-1])
+	for _, kind := range []string{"targets", "images"} {
+		name := strings.Trim(strings.TrimPrefix(table, kind+"."), `"`)
+		if strings.HasPrefix(table, kind+".") && name != "" {
+			return kind, name, nil
+		}
+	}
+	return "", "", fmt.Errorf("unknown table [%s], expected [targets.<name>] or [images.\"<file>\"]", table)
+}
+
+// imageOptions reads the keys of an [images."<file>"] table: padding,
+// trim = false to keep the transparent borders, position = [x, y] and
+// aliases = ["name", ...].
+func imageOptions(values map[string]string) (spritify.ImageOptions, error) {
+	var o spritify.ImageOptions
+	for key, value := range values {
+		var err error
+		switch key {
+		case "padding":
+			o.Padding, err = strconv.Atoi(value)
+		case "trim":
+			var trim bool
+			trim, err = strconv.ParseBool(value)
+			o.NoTrim = !trim
+		case "position":
+			var x, y int
+			if n, _ := fmt.Sscanf(value, "%d,%d", &x, &y); n != 2 {
+				err = fmt.Errorf("expected [x, y]")
+			}
+			o.Position = &image.Point{X: x, Y: y}
+		case "aliases":
+			o.Aliases = splitList(value)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			return o, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return o, nil
+}
+
+func parseConfigValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "["):
+		end := strings.LastIndex(raw, "]")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated array %s", raw)
+		}
+		var items []string
+		for _, item := range splitConfigArray(raw[1:end]) {
+			v, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(raw, `"`):
+		end := strings.LastIndex(raw, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.LastIndex(raw, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return raw[1:end], nil
+	}
+
+	if hash := strings.Index(raw, "#"); hash >= 0 {
+		raw = strings.TrimSpace(raw[:hash])
+	}
+	if raw == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return raw, nil
+}
+
+func splitConfigArray(body string) (items []string) {
+	var quote rune
+	start := 0
+	for i, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, strings.TrimSpace(body[start:i]))
+			start = i + 1
+		}
+	}
+
+	if last := strings.TrimSpace(body[start:]); last != "" {
+		items = append(items, last)
+	}
+	return
+}
+
+// loadTargets applies the config files to the flags and returns one target
+// per [targets.<name>] table, or a single unnamed target without tables.
+//
+// The -config file, or ./.sprite.toml without it, is read first, then its
+// table for the target, then <src>/.sprite.toml. Flags given explicitly on
+// the command line always win.
+func loadTargets() []target {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	rootConfig, _ := filepath.Abs(dirConfigName)
+	required := false
+	if *configPath != "" {
+		rootConfig, _ = filepath.Abs(*configPath)
+		required = true
+	}
+
+	cfg, err := parseConfig(rootConfig)
+	if err != nil {
+		if !os.IsNotExist(err) || required {
+			logger.Error(err.Error())
+			os.Exit(-1)
+		}
+		cfg = &config{path: rootConfig}
+	}
+	applyConfigValues(cfg.path, cfg.values, explicit)
+
+	if len(cfg.targets) == 0 {
+		return srcTargets("", rootConfig, cfg.images, explicit)
+	}
+
+	base := saveFlags()
+	var targets []target
+	for _, t := range cfg.targets {
+		restoreFlags(base)
+		applyConfigValues(cfg.path, t.values, explicit)
+		targets = append(targets, srcTargets(t.name, rootConfig, cfg.images, explicit)...)
+	}
+	return targets
+}
+
+// srcTargets applies <src>/.sprite.toml and returns the target, or with
+// -group-by-dir one target per immediate subdirectory of -src, named after
+// it and configured by its own .sprite.toml on top of the parent's. Image
+// tables of a src config override those of images file by file.
+func srcTargets(targetName string, rootConfig string, images map[string]spritify.ImageOptions, explicit map[string]bool) []target {
+	srcImages := applySrcConfig(rootConfig, images, explicit)
+	if !*groupByDir {
+		return []target{flagTarget(targetName, srcImages)}
+	}
+
+	parent := *src
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(-1)
+	}
+
+	base := saveFlags()
+	defer restoreFlags(base)
+
+	var targets []target
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		restoreFlags(base)
+		flag.Set("src", filepath.Join(parent, entry.Name()))
+		flag.Set("name", entry.Name())
+		groupImages := applySrcConfig(rootConfig, srcImages, explicit)
+
+		groupName := entry.Name()
+		if targetName != "" {
+			groupName = targetName + "/" + groupName
+		}
+		targets = append(targets, flagTarget(groupName, groupImages))
+	}
+
+	if len(targets) == 0 {
+		logger.Error(fmt.Sprintf("-group-by-dir: no subdirectories in %s", parent))
+		os.Exit(-1)
+	}
+	return targets
+}
+
+func saveFlags() map[string]string {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+func restoreFlags(values map[string]string) {
+	for key, value := range values {
+		// a list flag appends, so it is emptied first
+		if list, ok := flag.Lookup(key).Value.(*listFlag); ok {
+			*list = nil
+		}
+		flag.Set(key, value)
+	}
+}
+
+// applySrcConfig applies <src>/.sprite.toml to the flags and returns
+// images with its image tables merged in.
+func applySrcConfig(rootConfig string, images map[string]spritify.ImageOptions, explicit map[string]bool) map[string]spritify.ImageOptions {
+	srcConfig, err := filepath.Abs(filepath.Join(*src, dirConfigName))
+	if err != nil || srcConfig == rootConfig {
+		return images
+	}
+
+	cfg, err := parseConfig(srcConfig)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return images
+		}
+		logger.Error(err.Error())
+		os.Exit(-1)
+	}
+	if len(cfg.targets) > 0 {
+		logger.Error(fmt.Sprintf("%s: targets can only be defined in the top level config file", srcConfig))
+		os.Exit(-1)
+	}
+	applyConfigValues(cfg.path, cfg.values, explicit)
+
+	if len(cfg.images) == 0 {
+		return images
+	}
+	merged := make(map[string]spritify.ImageOptions, len(images)+len(cfg.images))
+	for name, o := range images {
+		merged[name] = o
+	}
+	for name, o := range cfg.images {
+		merged[name] = o
+	}
+	return merged
+}
+
+func applyConfigValues(pathname string, values map[string]string, explicit map[string]bool) {
+	for key, value := range values {
+		if explicit[key] {
+			continue
+		}
+		if key == "config" || flag.Lookup(key) == nil {
+			logger.Error(fmt.Sprintf("%s: unknown option %q", pathname, key))
+			os.Exit(-1)
+		}
+		if err := flag.Set(key, value); err != nil {
+			logger.Error(fmt.Sprintf("%s: %s: %v", pathname, key, err))
+			os.Exit(-1)
+		}
+	}
+}
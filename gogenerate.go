@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// Under go generate the command runs in the directory of the file holding
+// the //go:generate line, so relative paths already resolve from there. It
+// then only logs errors unless -v is given, and -format=go takes the package
+// of that file when it writes into the same directory.
+
+// underGoGenerate reports whether the command was started by go generate,
+// which sets $GOFILE and $GOPACKAGE.
+func underGoGenerate() bool {
+	return os.Getenv("GOFILE") != "" && os.Getenv("GOPACKAGE") != ""
+}
+
+// goGeneratePackage is the package -format=go defaults to for outputs in
+// dir: that of the go:generate line when dir is its directory.
+func goGeneratePackage(dir string) string {
+	if !underGoGenerate() {
+		return ""
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if abs, err := filepath.Abs(dir); err != nil || abs != cwd {
+		return ""
+	}
+	return os.Getenv("GOPACKAGE")
+}
+
+// writeOutputs writes files into dir, with -only-if-changed only those
+// whose content differs from what is there, so an unchanged build leaves
+// the files and their modification times alone.
+func writeOutputs(dir string, files []spritify.File) error {
+	if *ifChanged {
+		changed := make([]spritify.File, 0, len(files))
+		for _, f := range files {
+			if !unchanged(filepath.Join(dir, f.Name), f.Data) {
+				changed = append(changed, f)
+			}
+		}
+		files = changed
+	}
+	return spritify.WriteFiles(dir, files)
+}
+
+// writeOutput is writeOutputs for a single file outside the output
+// directory, like -report or -lock.
+func writeOutput(pathname string, data []byte) error {
+	if *ifChanged && unchanged(pathname, data) {
+		return nil
+	}
+	return spritify.WriteFileAtomic(pathname, data)
+}
+
+func unchanged(pathname string, data []byte) bool {
+	onDisk, err := os.ReadFile(pathname)
+	return err == nil && bytes.Equal(onDisk, data)
+}
@@ -1,216 +1,891 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
-	"image/draw"
-	"image/gif"
-	"image/jpeg"
+	"image/color"
 	"image/png"
-	"io"
-	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
 )
 
-type imgDecoder func(io.Reader) (image.Image, error)
+var (
+	configPath = flag.String("config", "", "read options from this file instead of ./.sprite.toml")
+	src        = flag.String("src", "./", "source dir where all the images located")
+	out        = flag.String("out", "./", "output dir, or - to write the only sheet to stdout and nothing else")
+	outRelSrc  = flag.Bool("out-relative-to-src", false, "resolve a relative -out against -src instead of the working directory")
+	name       = flag.String("name", "sprite", "name for the output without extension")
+	extensions = flag.String("extensions", strings.Join(spritify.DefaultOptions().Extensions, ","), "file extensions that will be included, e.g. jpg,png,gif")
+	groupByDir = flag.Bool("group-by-dir", false, "build one sprite per immediate subdirectory of -src, named after the directory")
+	svgSymbols = flag.Bool("svg-symbols", false, "instead of a raster sprite, wrap every svg source in a <symbol> of <name>.svg")
+	svgScale   = flag.Float64("svg-scale", 1, "rasterize svg sources at N times their size, e.g. 2 for retina; needs rsvg-convert")
+	exclude    = flag.String("exclude", "", "comma separated file name patterns to skip, e.g. *-old*,tmp_*")
+	urlList    = flag.String("urls", "", "file listing http or https image urls to fetch and pack next to -src, one per line; urls can also follow the flags")
+	fetchTime  = flag.Duration("fetch-timeout", 30*time.Second, "time limit of every attempt to fetch a url")
+	fetchTries = flag.Int("fetch-retries", 2, "further attempts at a url after a network or server error")
+	recursive  = flag.Bool("recursive", false, "also read the subdirectories of -src, naming icons by their path within it, e.g. ui/close.png")
+	sortBy     = flag.String("sort", "name", "packing order: name, size (tallest first) or area (largest first)")
+	resize     = flag.String("resize", "", "scale every source to WxH before packing, e.g. 32x32")
+	resizeMode = flag.String("resize-mode", "fit", "how -resize treats other aspect ratios: fit inside, fill and crop, or pad with transparency")
+	resizeFilt = flag.String("resize-filter", "catmull-rom", "-resize filter: nearest, bilinear, catmull-rom or lanczos")
+	variants   = flag.String("variants", "", "comma separated icon variants to generate, each grayscale and/or dim<percent> joined by +, optionally named, e.g. grayscale,disabled=grayscale+dim50")
+	states     = flag.Bool("states", false, "pack <name>--hover, --active and --disabled images next to <name> and emit :hover, :active and :disabled rules for its class")
+	keyframes  = flag.Bool("keyframes", false, "add a css @keyframes animation and .anim-<name> class for every numbered sequence like walk_001.png, walk_002.png and every -animation=strip gif")
+	fps        = flag.Int("fps", 12, "frame rate of -keyframes sequences; gifs keep their own frame delays")
+	animation  = flag.String("animation", "", "animated gifs: first-frame, skip, or strip to pack all frames side by side and list them in the manifest; unset warns and packs the first frame")
+	layout     = flag.String("layout", "vertical", "how images are arranged: vertical, horizontal, grid or binpack")
+	columns    = flag.Int("columns", 0, "cells per row for -layout=grid, 0 picks a near-square grid")
+	marginP    = flag.String("margin", "4", "gap between the images, and around them unless -padding is given; two values set the vertical and horizontal gap, e.g. \"4 8\"")
+	paddingP   = flag.String("padding", "", "space between the images and the sheet edges instead of -margin, one to four values like css, e.g. \"0 4\"")
+	extrudeP   = flag.Int("extrude", 0, "repeat the edge pixels of every image N times into its margin, against bleeding when the sheet is scaled; needs -margin of at least 2N")
+	prefix     = flag.String("prefix", "icon-", "class name prefix, available to -class-template as .Prefix")
+	classTpl   = flag.String("class-template", "{{ .Prefix }}{{ .Name | slug }}", "text/template for class names over .Prefix, .Name, .Base, .Ext, .Dir and .File, with slug and lower, e.g. {{ .Prefix }}{{ .Base | slug }}")
+	collision  = flag.String("on-collision", "error", "files rendering the same class: error, suffix to number the later ones -2, -3, ..., or skip them with a warning")
+	cssTplFile = flag.String("css-template", "", "render the stylesheet from this text/template file instead of the built-in rules")
+	htmlTpl    = flag.String("html-template", "", "render the demo page from this text/template file instead of the built-in page")
+	urlBase    = flag.String("css-url-base", "/", "url the css loads the sprite from, relative to the css (e.g. ../img/) or absolute (e.g. https://cdn.example.com/img/)")
+	embed      = flag.Bool("embed", false, "inline the sprite into the css as a base64 data uri instead of linking it")
+	anchor     = flag.String("anchor", "top-left", "corner the emitted background-position is relative to: top-left or bottom-right")
+	inset      = flag.Int("inset", 0, "grow each emitted icon rule by N px on every side, keeping the image centered")
+	maxRows    = flag.Int("max-rows", 0, "start a new sheet after N rows, 0 means a single sheet")
+	maxWidth   = flag.Int("max-width", 0, "start a new sheet rather than grow one wider than N px, 0 means no limit")
+	maxHeight  = flag.Int("max-height", 0, "start a new sheet rather than grow one taller than N px, 0 means no limit")
+	pot        = flag.Bool("pot", false, "round sheet dimensions up to powers of two, for use as GPU texture atlases")
+	background = flag.String("background", "transparent", "fill every sheet with this color before drawing, #rgb, #rrggbb, #rrggbbaa or transparent")
+	sheetTpl   = flag.String("sheet-name-tpl", "{{ .Name }}_{{ .Index }}", "text/template over .Name, .Index and .Number (from 1) for sheet names without extension when there are several sheets")
+	outFormat  = flag.String("output-format", "png", "sheet encoding: png, jpeg (or jpg), or webp and avif through cwebp and avifenc")
+	pngLevel   = flag.String("png-compression", "default", "png compression: default, best, speed or none; encoding dominates the run time of large sheets")
+	keepChunks = flag.String("png-keep-chunks", "", "comma separated ancillary png chunks, e.g. pHYs,iCCP, kept when -optimize-cmd adds them; every other one is stripped")
+	quantizeP  = flag.Int("quantize", 0, "write png sheets with a palette of at most N colors (2-256), 0 keeps full color")
+	dither     = flag.String("dither", "floyd-steinberg", "dithering when -quantize has to drop colors: floyd-steinberg or none")
+	quality    = flag.Int("quality", 0, "jpeg quality from 1 to 100, 0 means 90")
+	hashNames  = flag.Bool("hash", false, "name sheets <name>.<sha256-8>.png and reference the hashed name everywhere")
+	lockPath   = flag.String("lock", "", "pin every icon's position in this lock file, keyed by the hash of its source, and fail when unchanged inputs no longer give the locked sheets")
+	appendTo   = flag.Bool("append", false, "keep the icons of the previous <out>/<name>.json where they were and pack new ones into free space or below; implies -manifest")
+	cellAspect = flag.String("cell-aspect", "", "reserve cells of a fixed W:H ratio, e.g. 16:9, and center each image in its cell")
+	formatList = flag.String("format", "", "extra outputs, comma separated: scss, less, texturepacker-hash, texturepacker-array, typescript, react, webcomponent, go, unity, godot, cocos2d, starling, phaser")
+	goPackage  = flag.String("go-package", "", "package of the -format=go file, defaults to -name")
+	manifestP  = flag.Bool("manifest", false, "also write <name>.json with the sheet dimensions and icon coordinates")
+	manifestAs = newListFlag("manifest-format", "manifest formats, json, csv or yaml, repeatable or comma separated; implies -manifest")
+	demoA11y   = flag.Bool("demo-a11y", false, "annotate demo icons with role, aria-label and a visually hidden label")
+	debugSVG   = flag.Bool("debug-svg", false, "also write <name>.debug.svg showing where every image was packed")
+	emitBase64 = flag.Bool("emit-base64", false, "also write the base64-encoded sprite to <name>.png.b64")
+	report     = flag.String("report", "", "write a plain text layout report to this file")
+	dryRun     = flag.Bool("dry-run", false, "lay the sprite out and print the files, sheet sizes and classes it would write, writing nothing")
+	showStats  = flag.Bool("stats", false, "log icon count, sheet sizes, packing efficiency, bytes in and out and time per phase")
+	statsJSON  = flag.String("stats-json", "", "write the -stats numbers as json to this file")
+	dedupe     = flag.Bool("dedupe", false, "pack pixel-identical images once and point all of their classes at it")
+	densities  = flag.String("densities", "", "comma separated pixel densities such as 1,2,3: the sources are at the largest, and a sheet is written per density with media queries choosing between them")
+	retina     = flag.Bool("retina", false, "pair <name>@2x images with <name> and also write <sheet>@2x.png with a media query")
+	trim       = flag.Bool("trim", false, "crop fully transparent borders from every image before packing")
+	trimThresh = flag.Int("trim-threshold", 0, "with -trim, treat pixels with alpha at or below N (0-255) as transparent")
+	lowMemory  = flag.Bool("low-memory", false, "read only image sizes up front and decode each image while drawing it; not with -trim, -dedupe or -retina")
+	strict     = flag.Bool("strict", false, "fail without writing anything when a source file cannot be read")
+	jobs       = flag.Int("jobs", runtime.NumCPU(), "number of parallel workers")
+	maxImages  = flag.Int("max-images", 0, "refuse to run when more than N files match, 0 means no limit")
+	allowEmpty = flag.Bool("allow-empty", false, "write an empty sprite when no file matches instead of failing")
+	postCmd    = flag.String("post-cmd", "", "shell command run after the sprite is written, {} is replaced by the sprite path")
+	optimize   = flag.String("optimize-cmd", "", "shell command every encoded sheet is piped through before it is written, or run on a temporary copy named by {}")
+	ifChanged  = flag.Bool("only-if-changed", false, "write only the outputs whose content changed, leaving the others and their modification times alone")
+	checkOnly  = flag.Bool("check", false, "generate in memory and fail if the outputs on disk differ, writing nothing")
+	useCache   = flag.Bool("cache", false, "skip the build when neither the inputs nor the options changed since the last one, tracked in <out>/.<name>.cache")
+	watch      = flag.Bool("watch", false, "keep running and rebuild whenever a file in -src is added, changed or removed")
+	addr       = flag.String("addr", "localhost:8080", "address the serve and api subcommands listen on")
+	maxUpload  = flag.Int64("max-upload", 32, "largest request body the api subcommand accepts, in MiB")
+	watchEvery = flag.Duration("watch-interval", 500*time.Millisecond, "how often -watch polls the source directory")
+	verbose    = flag.Bool("v", false, "also log the progress of every build")
+	quiet      = flag.Bool("q", false, "log errors only")
+	logFormat  = flag.String("log-format", "text", "text for plain lines or json for one object per line")
+	progress   = flag.Bool("progress", false, "draw progress bars for decoding, packing and encoding on stderr")
+)
 
-type myImage struct {
-	img   image.Image
-	name  string
-	point image.Point
+func splitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
 }
 
-type myImageSlice []myImage
+// listFlag is a flag that can be repeated, every value a comma separated
+// list like splitList takes.
+type listFlag []string
 
-var (
-	src        = flag.String("src", "./", "source dir where all the images located")
-	out        = flag.String("out", "./", "output dir")
-	name       = flag.String("name", "sprite", "name for the output without extension")
-	extensions = flag.String("extensions", "jpg,png", "file extensions that will be included, e.g. jpg,png,gif")
-	marginP    = flag.Int("margin", 4, "margin between each component, also between the new image borders")
+func newListFlag(name string, usage string) *listFlag {
+	l := new(listFlag)
+	flag.Var(l, name, usage)
+	return l
+}
 
-	margin         int
-	filenameFilter *regexp.Regexp
-	myImages       myImageSlice
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
 
-	wg            *sync.WaitGroup = new(sync.WaitGroup)
-	imgBufferLock *sync.Mutex     = new(sync.Mutex)
-)
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, splitList(value)...)
+	return nil
+}
 
-func init() {
-	flag.Parse()
+// manifestFormats are the -manifest-format values, with json added when
+// -append needs to read it back.
+func manifestFormats() []string {
+	formats := append([]string(nil), *manifestAs...)
+	if len(formats) == 0 || !*appendTo {
+		return formats
+	}
+	for _, format := range formats {
+		if format == spritify.ManifestJSON {
+			return formats
+		}
+	}
+	return append(formats, spritify.ManifestJSON)
+}
 
-	exts := strings.Split(*extensions, ",")
-	filenameFilter = regexp.MustCompile(".*\\.(?i:" + strings.Join(exts, "|") + ")")
-	margin = *marginP
+// sourceURLs are the urls of -urls followed by those after the flags.
+func sourceURLs() []string {
+	var urls []string
+	if *urlList != "" {
+		data, err := os.ReadFile(*urlList)
+		if err != nil {
+			logger.Error(fmt.Sprint("-urls: ", err))
+			os.Exit(-1)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				urls = append(urls, line)
+			}
+		}
+	}
+	return append(urls, flag.Args()...)
 }
 
-func getImagesAbsPath(root string, filter *regexp.Regexp) (imagenames []string) {
-	absPath, err := filepath.Abs(root)
-	if err != nil {
-		fmt.Println(err)
+// fetchRetries turns -fetch-retries into Options.FetchRetries, where 0 means
+// the default.
+func fetchRetries(n int) int {
+	if n == 0 {
+		return -1
+	}
+	return n
+}
+
+// excludeList splits -exclude like splitList but keeps the case, file names
+// are matched as they are on disk.
+func excludeList(list string) (patterns []string) {
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return
+}
+
+// target is one sprite to build, resolved from the flags after the config
+// files have been applied.
+type target struct {
+	name    string // table name in the config file, empty without targets
+	opts    spritify.Options
+	out     string // output directory, already resolved against -src if asked
+	report  string
+	postCmd string
+	optCmd  string
+	symbols bool // build an svg symbol sprite instead of packing sheets
+	cache   bool
+	check   bool // compare with the outputs on disk instead of writing
+	append  bool // lay out around the previous manifest in out
+	lock    string
+	stats   string // -stats-json file
+
+	// -svg-scale when svg sources are rasterized, else 0; it is not part of
+	// opts, so the cache key takes it from here
+	svgZoom float64
+}
+
+func parseTargets(args []string) []target {
+	flag.CommandLine.Parse(args)
+	targets := loadTargets()
+
+	// every target decodes through the same pool, so -jobs caps the
+	// whole run rather than each target
+	decoders := spritify.NewPool(*jobs)
+	written := make(map[string]string)
+	for i := range targets {
+		targets[i].opts.Decoders = decoders
+
+		absOut, _ := filepath.Abs(targets[i].out)
+		key := filepath.Join(absOut, targets[i].opts.Name)
+		if other, ok := written[key]; ok {
+			logger.Error(fmt.Sprintf("targets %s and %s both write %s", other, targets[i].name, key))
+			os.Exit(-1)
+		}
+		written[key] = targets[i].name
+	}
+
+	return targets
+}
+
+// flagTarget captures the current flag values as a target.
+func flagTarget(targetName string, images map[string]spritify.ImageOptions) target {
+	// the config files are applied by now, so is any -v, -q or -log-format
+	setupLogger()
+
+	opts := spritify.Options{
+		Images:            images,
+		Src:               *src,
+		Extensions:        splitList(*extensions),
+		Exclude:           excludeList(*exclude),
+		Recursive:         *recursive,
+		URLs:              sourceURLs(),
+		FetchTimeout:      *fetchTime,
+		FetchRetries:      fetchRetries(*fetchTries),
+		Name:              *name,
+		MaxImages:         *maxImages,
+		AllowEmpty:        *allowEmpty,
+		Sort:              *sortBy,
+		ResizeMode:        *resizeMode,
+		ResizeFilter:      *resizeFilt,
+		Animation:         *animation,
+		States:            *states,
+		Keyframes:         *keyframes,
+		FPS:               *fps,
+		Layout:            *layout,
+		Columns:           *columns,
+		Extrude:           *extrudeP,
+		MaxRows:           *maxRows,
+		MaxWidth:          *maxWidth,
+		MaxHeight:         *maxHeight,
+		PowerOfTwo:        *pot,
+		SheetNameTemplate: *sheetTpl,
+		OutputFormat:      strings.ToLower(*outFormat),
+		Quality:           *quality,
+		Quantize:          *quantizeP,
+		Dither:            *dither,
+		Hash:              *hashNames,
+		Dedupe:            *dedupe,
+		Retina:            *retina,
+		Trim:              *trim,
+		Jobs:              *jobs,
+		LowMemory:         *lowMemory,
+		Strict:            *strict,
+		DryRun:            *dryRun,
+		ClassPrefix:       *prefix,
+		ClassTemplate:     *classTpl,
+		OnCollision:       *collision,
+		Embed:             *embed,
+		URLBase:           *urlBase,
+		Inset:             *inset,
+		Anchor:            *anchor,
+		DemoA11y:          *demoA11y,
+		Formats:           splitList(*formatList),
+		Manifest:          *manifestP || *appendTo || len(*manifestAs) > 0,
+		ManifestFormats:   manifestFormats(),
+		DebugSVG:          *debugSVG,
+		Base64:            *emitBase64,
+		GoPackage:         *goPackage,
+	}
+
+	for _, item := range splitList(*densities) {
+		d, err := strconv.Atoi(item)
+		if err != nil || d < 1 {
+			logger.Error("invalid -densities, expected a list such as 1,2,3")
+			os.Exit(-1)
+		}
+		opts.Densities = append(opts.Densities, d)
+	}
+
+	if *resize != "" {
+		var w, h int
+		if n, err := fmt.Sscanf(*resize, "%dx%d", &w, &h); err != nil || n != 2 || w <= 0 || h <= 0 {
+			logger.Error("invalid -resize, expected WxH such as 32x32")
+			os.Exit(-1)
+		}
+		opts.Resize = image.Pt(w, h)
+	}
+
+	for _, spec := range splitList(*variants) {
+		v, err := spritify.ParseVariant(spec)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(-1)
+		}
+		opts.Variants = append(opts.Variants, v)
+	}
+
+	registerOutputFormat(opts.OutputFormat)
+
+	var svgZoom float64
+	for _, ext := range opts.Extensions {
+		if ext == "svg" {
+			if *svgScale <= 0 {
+				logger.Error("invalid -svg-scale, expected a positive number")
+				os.Exit(-1)
+			}
+			opts.ExtDecoders = map[string]spritify.Decoder{"svg": svgDecoder(*svgScale)}
+			svgZoom = *svgScale
+		}
+	}
+
+	switch *pngLevel {
+	case "default":
+		opts.Compression = png.DefaultCompression
+	case "best":
+		opts.Compression = png.BestCompression
+	case "speed":
+		opts.Compression = png.BestSpeed
+	case "none":
+		opts.Compression = png.NoCompression
+	default:
+		logger.Error("invalid -png-compression, expected default, best, speed or none")
 		os.Exit(-1)
 	}
+	// chunk types are case sensitive, so not through splitList
+	for _, kind := range strings.Split(*keepChunks, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			opts.KeepPNGChunks = append(opts.KeepPNGChunks, kind)
+		}
+	}
 
-	filenames, err := filepath.Glob(filepath.Join(absPath, "*"))
+	bg, err := parseColor(*background)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(-2)
+		logger.Error(fmt.Sprintf("invalid -background: %v", err))
+		os.Exit(-1)
 	}
+	opts.Background = bg
+
+	opts.CSSTemplate = readTemplateFile(*cssTplFile)
+	opts.HTMLTemplate = readTemplateFile(*htmlTpl)
 
-	for _, x := range filenames {
-		if filter.MatchString(x) {
-			imagenames = append(imagenames, x)
+	if *cellAspect != "" {
+		var rw, rh int
+		if _, err := fmt.Sscanf(*cellAspect, "%d:%d", &rw, &rh); err != nil || rw <= 0 || rh <= 0 {
+			logger.Error("invalid -cell-aspect, expected W:H such as 16:9")
+			os.Exit(-1)
 		}
+		opts.CellAspect = image.Pt(rw, rh)
 	}
 
-	return
+	if *trimThresh < 0 || *trimThresh > 255 {
+		logger.Error("invalid -trim-threshold, expected 0-255")
+		os.Exit(-1)
+	}
+	opts.TrimThreshold = uint8(*trimThresh)
+
+	margin := spacingList("margin", *marginP, 2)
+	opts.Margin = margin[0]
+	if len(margin) == 2 {
+		opts.Gap = &image.Point{X: margin[1], Y: margin[0]}
+		opts.Padding = &spritify.Insets{Top: margin[0], Right: margin[1], Bottom: margin[0], Left: margin[1]}
+	}
+	if *paddingP != "" {
+		padding := cssInsets(spacingList("padding", *paddingP, 4))
+		opts.Padding = &padding
+	}
+
+	if gap := margin[len(margin)-1]; *inset > margin[0] || *inset > gap {
+		logger.Warn("warning: -inset is larger than -margin, neighbouring icons will show inside the inset area")
+	}
+
+	if *optimize != "" {
+		opts.Optimize = optimizer(*optimize)
+	}
+
+	outDir := *out
+	if *outRelSrc && !filepath.IsAbs(outDir) && outDir != "-" {
+		outDir = filepath.Join(*src, outDir)
+	}
+	if *lockPath != "" && len(opts.URLs) > 0 {
+		logger.Error("-lock hashes the source files and cannot be combined with urls")
+		os.Exit(-1)
+	}
+	if *useCache && len(opts.URLs) > 0 {
+		logger.Error("-cache hashes the source files and cannot be combined with urls")
+		os.Exit(-1)
+	}
+	if outDir == "-" && (*useCache || *postCmd != "") {
+		logger.Error("-out - writes to stdout and cannot be combined with -cache or -post-cmd")
+		os.Exit(-1)
+	}
+	if opts.GoPackage == "" {
+		opts.GoPackage = goGeneratePackage(outDir)
+	}
+
+	return target{
+		name:    targetName,
+		opts:    opts,
+		out:     outDir,
+		report:  *report,
+		postCmd: *postCmd,
+		optCmd:  *optimize,
+		symbols: *svgSymbols,
+		cache:   *useCache,
+		check:   *checkOnly,
+		append:  *appendTo,
+		lock:    *lockPath,
+		stats:   *statsJSON,
+		svgZoom: svgZoom,
+	}
 }
 
-func readImage(p string) {
-	defer wg.Done()
+// parseColor reads a css hex color, or transparent for none.
+func parseColor(value string) (color.Color, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "transparent" {
+		return nil, nil
+	}
 
-	handler, err := os.Open(p)
-	if err != nil {
-		fmt.Println(err)
-		runtime.Goexit()
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var long []byte
+		for i := range hex {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 || !strings.HasPrefix(value, "#") {
+		return nil, fmt.Errorf("%q is not #rgb, #rrggbb, #rrggbbaa or transparent", value)
+	}
+	return color.NRGBA{uint8(rgba >> 24), uint8(rgba >> 16), uint8(rgba >> 8), uint8(rgba)}, nil
+}
+
+// spacingList parses up to max space or comma separated pixel values of the
+// named flag.
+func spacingList(flagName string, value string, max int) []int {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+
+	values := make([]int, 0, len(fields))
+	for _, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSuffix(field, "px"))
+		if err != nil || n < 0 {
+			values = nil
+			break
+		}
+		values = append(values, n)
 	}
 
-	var decoder imgDecoder
-	switch strings.ToLower(filepath.Ext(p)) {
-	case ".png":
-		decoder = png.Decode
-	case ".jpg":
-		decoder = jpeg.Decode
-	case ".gif":
-		decoder = gif.Decode
+	if len(values) == 0 || len(values) > max {
+		logger.Error(fmt.Sprintf("invalid -%s %q, expected 1 to %d non-negative pixel values", flagName, value, max))
+		os.Exit(-1)
 	}
+	return values
+}
 
-	img, err := decoder(handler)
+// cssInsets expands one to four values the way css padding does.
+func cssInsets(v []int) spritify.Insets {
+	switch len(v) {
+	case 1:
+		return spritify.UniformInsets(v[0])
+	case 2:
+		return spritify.Insets{Top: v[0], Right: v[1], Bottom: v[0], Left: v[1]}
+	case 3:
+		return spritify.Insets{Top: v[0], Right: v[1], Bottom: v[2], Left: v[1]}
+	}
+	return spritify.Insets{Top: v[0], Right: v[1], Bottom: v[2], Left: v[3]}
+}
 
+func readTemplateFile(pathname string) string {
+	if pathname == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(pathname)
 	if err != nil {
-		fmt.Println(err)
-		runtime.Goexit()
+		logger.Error(err.Error())
+		os.Exit(-1)
 	}
+	return string(data)
+}
 
-	imgBufferLock.Lock()
-	myImages = append(myImages, myImage{
-		img:  img,
-		name: filepath.Base(p),
-	})
-	imgBufferLock.Unlock()
+// outputDir resolves outDir and creates it when it does not exist yet.
+func outputDir(outDir string) (string, error) {
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return "", err
+	}
+
+	dirH, err := os.Stat(absOut)
+	switch {
+	case os.IsNotExist(err):
+		return absOut, os.MkdirAll(absOut, 0775)
+	case err != nil:
+		return "", err
+	case !dirH.IsDir():
+		return "", fmt.Errorf("output %s should be a directory", absOut)
+	}
+	return absOut, nil
+}
+
+// runPostCmd runs -post-cmd on spritePath. A failure is returned for the
+// caller to report, so other targets and a watch session carry on.
+func runPostCmd(command string, spritePath string) error {
+	cmd := exec.Command("sh", "-c", strings.Replace(command, "{}", shellQuote(spritePath), -1))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("post-cmd %q: %w", command, err)
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
 }
 
-func getProductSize() image.Rectangle {
-	var w int = 0
-	var h int = 0
+// stdout is kept aside for -out -, which has every notice and error from
+// then on go to stderr.
+var stdout = os.Stdout
 
-	for _, i := range myImages {
-		rect := i.img.Bounds()
-		w = int(math.Max(float64(w), float64(rect.Dx())))
-		h += rect.Dy()
+// build generates the sprite for t and writes every output.
+func build(t target) error {
+	if t.out == "-" {
+		os.Stdout = os.Stderr
 	}
 
-	h += margin * (len(myImages) + 1)
-	w += 2 * margin
+	var key string
+	if t.cache && !t.check && !t.opts.DryRun {
+		var err error
+		if key, err = cacheKey(t); err != nil {
+			return t.errorf(err)
+		}
+		if cacheFresh(t, key) {
+			t.log().Info(t.opts.Name + " is up to date")
+			return nil
+		}
+	}
 
-	return image.Rect(0, 0, w, h)
+	var written []string
+	var err error
+	if t.symbols {
+		written, err = buildSymbols(t)
+	} else {
+		written, err = buildSheets(t)
+	}
+
+	if err == nil && t.cache && !t.check && !t.opts.DryRun {
+		err = t.errorf(writeCache(t, key, written))
+	}
+	return err
 }
 
-func fillInSprite(rect image.Rectangle) *image.NRGBA {
-	var nrgba *image.NRGBA = image.NewNRGBA(rect)
-	var left int = margin
-	var top int = margin
+// generate packs the sheets of t in memory, printing the warnings, and
+// renders every output. ctx cancels the build, e.g. when an api client goes
+// away.
+func generate(ctx context.Context, t target) (*spritify.Result, []spritify.File, error) {
+	if t.append {
+		previous, err := previousLayout(t)
+		if err != nil {
+			return nil, nil, t.errorf(err)
+		}
+		t.opts.Previous = previous
+	}
 
-	for idx, i := range myImages {
-		wg.Add(1)
+	var lock *lockFile
+	unchanged := false
+	if t.lock != "" {
+		var err error
+		if lock, err = readLock(t); err != nil {
+			return nil, nil, t.errorf(err)
+		}
+	}
+	if lock != nil {
+		locked, allLocked, err := lockedRegions(t, lock)
+		if err != nil {
+			return nil, nil, t.errorf(err)
+		}
+		// locked rectangles win over those of -append
+		names := make(map[string]bool, len(locked))
+		for _, region := range locked {
+			names[region.Name] = true
+		}
+		for _, region := range t.opts.Previous {
+			if !names[region.Name] {
+				locked = append(locked, region)
+			}
+		}
+		t.opts.Previous = locked
+		unchanged = allLocked
+	}
 
-		go (func(img image.Image, left int, top int) {
-			defer wg.Done()
-			draw.Draw(nrgba, image.Rect(left, top, left+img.Bounds().Dx(), top+img.Bounds().Dy()), img, image.ZP, draw.Src)
-		})(i.img, left, top)
+	opts := t.opts
+	opts.Logger = t.log()
+	if *progress {
+		opts.Progress = progressBar(t)
+	}
+	result, err := spritify.GenerateContext(ctx, opts)
+	if err != nil {
+		return nil, nil, t.errorf(err)
+	}
+	if unchanged {
+		if err := verifyLock(t, lock, result); err != nil {
+			return nil, nil, t.errorf(err)
+		}
+	}
 
-		myImages[idx].point = image.Pt(left, top)
-		top += i.img.Bounds().Dy() + margin
+	if t.opts.Dedupe {
+		var count, pixels int
+		for _, icon := range result.Icons {
+			if icon.DuplicateOf != nil {
+				count++
+				pixels += icon.Rect.Dx() * icon.Rect.Dy()
+			}
+		}
+		if count > 0 {
+			t.log().Info(fmt.Sprintf("dedupe: packed %d duplicate images once, saving %d px", count, pixels))
+		}
 	}
 
-	wg.Wait()
+	files, err := result.Files()
+	if err != nil {
+		return nil, nil, t.errorf(err)
+	}
+	return result, files, nil
+}
 
-	return nrgba
+// previousLayout reads the regions of the manifest the last build of t
+// wrote. There is none before the first build, which packs from scratch.
+func previousLayout(t target) ([]spritify.Region, error) {
+	pathname := filepath.Join(t.out, t.opts.Name+".json")
+	data, err := os.ReadFile(pathname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := spritify.ParseManifest(data, image.ZP)
+	if err != nil {
+		return nil, fmt.Errorf("-append: %s: %v", pathname, err)
+	}
+	return regions, nil
 }
 
-func writeSprite(nrgba *image.NRGBA) {
-	absOut, err := filepath.Abs(*out)
+// buildSheets packs the sheets of t and returns the paths it wrote.
+func buildSheets(t target) ([]string, error) {
+	result, files, err := generate(context.Background(), t)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(-127)
+		return nil, err
+	}
+	if t.opts.DryRun {
+		printPlan(t, result, files)
+		return nil, t.unreadable(result.Errors)
 	}
 
-	dirH, err := os.Stat(absOut)
+	var lock []byte
+	if t.lock != "" {
+		if lock, err = lockData(t, result); err != nil {
+			return nil, t.errorf(err)
+		}
+	}
+
+	if t.check {
+		if t.report != "" {
+			absReport, _ := filepath.Abs(t.report)
+			files = append(files, spritify.File{Name: absReport, Data: result.LayoutReport()})
+		}
+		if t.lock != "" {
+			absLock, _ := filepath.Abs(t.lock)
+			files = append(files, spritify.File{Name: absLock, Data: lock})
+		}
+		return nil, checkTarget(t, files)
+	}
+
+	if t.out == "-" {
+		if len(result.Sheets) != 1 {
+			return nil, t.errorf(fmt.Errorf("-out -: stdout takes a single sheet, got %d", len(result.Sheets)))
+		}
+		if _, err := result.Sheets[0].WriteTo(stdout); err != nil {
+			return nil, t.errorf(err)
+		}
+		return nil, t.unreadable(result.Errors)
+	}
+
+	absOut, err := outputDir(t.out)
 	if err != nil {
-		if os.IsNotExist(err) {
-			e := os.MkdirAll(absOut, 0775)
-			if e != nil {
-				fmt.Println(e)
-				os.Exit(-1)
+		return nil, t.errorf(err)
+	}
+	if err := writeOutputs(absOut, files); err != nil {
+		return nil, t.errorf(err)
+	}
+	t.log().Debug("wrote outputs", "dir", absOut, "files", len(files))
+	written := writtenPaths(absOut, files)
+
+	if t.report != "" {
+		if err := writeOutput(t.report, result.LayoutReport()); err != nil {
+			return nil, t.errorf(err)
+		}
+		written = append(written, t.report)
+	}
+
+	if t.lock != "" {
+		if err := writeOutput(t.lock, lock); err != nil {
+			return nil, t.errorf(err)
+		}
+		written = append(written, t.lock)
+	}
+
+	if *showStats {
+		logStats(t, result.Stats())
+	}
+	if t.stats != "" {
+		data, err := result.Stats().JSON()
+		if err == nil {
+			err = writeOutput(t.stats, data)
+		}
+		if err != nil {
+			return nil, t.errorf(err)
+		}
+	}
+
+	if t.postCmd != "" {
+		for _, sheet := range result.Sheets {
+			if err := runPostCmd(t.postCmd, filepath.Join(absOut, sheet.Filename)); err != nil {
+				return nil, t.errorf(err)
 			}
+		}
+	}
+
+	return written, t.unreadable(result.Errors)
+}
+
+// printPlan lists what a build of t would write and, for sheets, where
+// every image and class would end up.
+func printPlan(t target, result *spritify.Result, files []spritify.File) {
+	absOut, _ := filepath.Abs(t.out)
+	sheets := make(map[string]*spritify.Sheet)
+	if result != nil {
+		for _, sheet := range result.Sheets {
+			sheets[sheet.Filename] = sheet
+		}
+	}
+
+	for _, f := range files {
+		pathname := filepath.Join(absOut, f.Name)
+		if sheet, ok := sheets[f.Name]; ok {
+			b := sheet.Image.Bounds()
+			fmt.Fprintf(stdout, "%swould write %s %dx%d with %d images\n", t.prefix(), pathname, b.Dx(), b.Dy(), len(sheet.Icons))
 		} else {
-			fmt.Println(err)
-			os.Exit(-128)
+			fmt.Fprintf(stdout, "%swould write %s\n", t.prefix(), pathname)
+		}
+	}
+	for _, extra := range []string{t.report, t.lock, t.stats} {
+		if extra != "" {
+			fmt.Fprintf(stdout, "%swould write %s\n", t.prefix(), extra)
 		}
-	} else if !dirH.IsDir() {
-		fmt.Println("output should be a directory!")
-		os.Exit(-1)
 	}
 
-	spriteFilename := *name + ".png"
-	spriteFile, err := os.Create(filepath.Join(absOut, spriteFilename))
-	png.Encode(spriteFile, nrgba)
+	if result == nil {
+		return
+	}
+	for _, icon := range result.Icons {
+		fmt.Fprintf(stdout, "  .%s  %s  %dx%d at %d,%d on %s\n", icon.ClassName(), icon.Name, icon.Rect.Dx(), icon.Rect.Dy(), icon.Rect.Min.X, icon.Rect.Min.Y, result.Sheets[icon.Sheet].Filename)
+	}
+}
 
-	generateDemo(filepath.Join(absOut, *name+".html"), spriteFilename)
+func (t target) prefix() string {
+	if t.name == "" {
+		return ""
+	}
+	return t.name + ": "
 }
 
-func generateDemo(demoPathname string, spriteFilename string) {
-	var className string
-	divTags := make([]string, 0, len(myImages))
-	cssBlocks := make([]string, 0, len(myImages))
+func writtenPaths(dir string, files []spritify.File) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(dir, f.Name)
+	}
+	return paths
+}
+
+// unreadable is the error a build ends with when some files had to be left
+// out, after everything else was written.
+func (t target) unreadable(errors []string) error {
+	if len(errors) == 0 {
+		return nil
+	}
+	return t.errorf(fmt.Errorf("%d files could not be read and were left out", len(errors)))
+}
+
+// buildSymbols writes the svg symbol sprite of t and returns the paths it
+// wrote.
+func buildSymbols(t target) ([]string, error) {
+	sprite, files, err := generateSymbols(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.opts.DryRun {
+		printPlan(t, nil, files)
+		for _, symbol := range sprite.Symbols {
+			fmt.Fprintf(stdout, "  #%s  %s\n", symbol.ID, symbol.Name)
+		}
+		return nil, t.unreadable(sprite.Errors)
+	}
 
-	cssBlocks = append(cssBlocks, fmt.Sprintf(`.icon { background: url("/%s") no-repeat; }`, spriteFilename))
+	if t.check {
+		return nil, checkTarget(t, files)
+	}
 
-	for _, i := range myImages {
-		className = "icon-" + strings.Replace(i.name, ".", "-", -1)
-		divTags = append(divTags, fmt.Sprintf(`<div class="icon %s"></div>`, className))
-		cssBlocks = append(cssBlocks, fmt.Sprintf(".%s { background-position: left %dpx top %dpx; width:%dpx; height:%dpx;}", className, -i.point.X, -i.point.Y, i.img.Bounds().Dx(), i.img.Bounds().Dy()))
+	if t.out == "-" {
+		_, err := files[0].WriteTo(stdout)
+		return nil, t.errorf(err)
 	}
 
-	htmlTemplate := `<html><head><style type="text/css">%s</style></head><body>%s</body></html>`
-	htmlHandler, err := os.Create(demoPathname)
+	absOut, err := outputDir(t.out)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(-1)
+		return nil, t.errorf(err)
+	}
+	if err := writeOutputs(absOut, files); err != nil {
+		return nil, t.errorf(err)
 	}
 
-	htmlHandler.WriteString(fmt.Sprintf(htmlTemplate, strings.Join(cssBlocks, ""), strings.Join(divTags, "")))
-	htmlHandler.Sync()
+	if t.postCmd != "" {
+		if err := runPostCmd(t.postCmd, filepath.Join(absOut, sprite.Filename())); err != nil {
+			return nil, t.errorf(err)
+		}
+	}
+
+	return writtenPaths(absOut, files), t.unreadable(sprite.Errors)
 }
 
-func main() {
-	imagenames := getImagesAbsPath(*src, filenameFilter)
+// generateSymbols builds the svg symbol sprite of t in memory, printing the
+// files it could not read.
+func generateSymbols(t target) (*spritify.SymbolSprite, []spritify.File, error) {
+	opts := t.opts
+	opts.Logger = t.log()
+	sprite, err := spritify.GenerateSymbols(opts)
+	if err != nil {
+		return nil, nil, t.errorf(err)
+	}
 
-	myImages = make(myImageSlice, 0, len(imagenames))
+	return sprite, sprite.Files(), nil
+}
 
-	for _, i := range imagenames {
-		wg.Add(1)
-		go readImage(i)
+func (t target) errorf(err error) error {
+	if err == nil || t.name == "" {
+		return err
 	}
+	return fmt.Errorf("%s: %w", t.name, err)
+}
 
-	wg.Wait()
-
-	writeSprite(fillInSprite(getProductSize()))
+func main() {
+	flag.Usage = usage
+	cmd, args := findCommand(os.Args[1:])
+	cmd.run(args)
 }
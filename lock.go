@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// The lock file pins the layout: every icon's rectangle together with the
+// hash of the source it was cut from, and the hash of every sheet built
+// from them. Icons whose source is unchanged keep their rectangle on the
+// next build, and a build whose inputs all match the lock has to reproduce
+// the locked sheets byte for byte.
+
+const lockVersion = 1
+
+type lockFile struct {
+	Version int         `json:"version"`
+	Options string      `json:"options"` // see lockOptions
+	Sheets  []lockSheet `json:"sheets"`
+	Icons   []lockIcon  `json:"icons"`
+}
+
+type lockSheet struct {
+	Image  string `json:"image"`
+	SHA256 string `json:"sha256"`
+}
+
+type lockIcon struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"` // file a variant was derived from
+	SHA256 string `json:"sha256"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// readLock returns the lock of t, or nil before the first locked build.
+func readLock(t target) (*lockFile, error) {
+	data, err := os.ReadFile(t.lock)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &lockFile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("%s: %v", t.lock, err)
+	}
+	if lock.Version != lockVersion {
+		return nil, fmt.Errorf("%s: unsupported lock version %d", t.lock, lock.Version)
+	}
+	return lock, nil
+}
+
+// lockedRegions lists the rectangles of the locked icons whose source is
+// unchanged, and whether that is all of them.
+func lockedRegions(t target, lock *lockFile) ([]spritify.Region, bool, error) {
+	var regions []spritify.Region
+	unchanged := true
+	for _, icon := range lock.Icons {
+		source := icon.Name
+		if icon.Source != "" {
+			source = icon.Source
+		}
+		sum, err := hashFile(filepath.Join(t.opts.Src, filepath.FromSlash(source)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, false, err
+		}
+		if sum != icon.SHA256 {
+			unchanged = false
+			continue
+		}
+		regions = append(regions, spritify.Region{
+			Name: icon.Name,
+			Rect: image.Rect(icon.X, icon.Y, icon.X+icon.Width, icon.Y+icon.Height),
+		})
+	}
+	return regions, unchanged, nil
+}
+
+// sourceName is pathname relative to the source directory of t, slash
+// separated like the icon names of a -recursive build.
+func sourceName(t target, pathname string) string {
+	if src, err := filepath.Abs(t.opts.Src); err == nil {
+		if rel, err := filepath.Rel(src, pathname); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(pathname)
+}
+
+// lockOptions hashes the options that shape the sheets, leaving out those
+// that differ between machines without changing a pixel.
+func lockOptions(t target) string {
+	opts := t.opts
+	opts.Src = ""
+	opts.Jobs = 0
+	opts.Previous = nil
+
+	sum := sha256.Sum256([]byte(optionsString(opts) + t.optCmd))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyLock fails when result was built from exactly the locked inputs and
+// options but its sheets came out different, e.g. from another png encoder.
+func verifyLock(t target, lock *lockFile, result *spritify.Result) error {
+	if lock.Options != lockOptions(t) || len(result.Icons) != len(lock.Icons) || len(result.Sheets) != len(lock.Sheets) {
+		return nil
+	}
+
+	for idx, sheet := range result.Sheets {
+		sum := sha256.Sum256(sheet.Data)
+		if hex.EncodeToString(sum[:]) != lock.Sheets[idx].SHA256 {
+			return fmt.Errorf("%s: %s differs from the locked build although no input changed; delete the lock to accept it", t.lock, sheet.Filename)
+		}
+	}
+	return nil
+}
+
+// lockData renders the lock recording the layout of result.
+func lockData(t target, result *spritify.Result) ([]byte, error) {
+	lock := lockFile{Version: lockVersion, Options: lockOptions(t)}
+	for _, sheet := range result.Sheets {
+		sum := sha256.Sum256(sheet.Data)
+		lock.Sheets = append(lock.Sheets, lockSheet{sheet.Filename, hex.EncodeToString(sum[:])})
+	}
+
+	for _, icon := range result.Icons {
+		sum, err := hashFile(icon.Path())
+		if err != nil {
+			return nil, err
+		}
+		var source string
+		if file := sourceName(t, icon.Path()); file != icon.Name {
+			source = file
+		}
+		lock.Icons = append(lock.Icons, lockIcon{
+			Name:   icon.Name,
+			Source: source,
+			SHA256: sum,
+			X:      icon.Rect.Min.X,
+			Y:      icon.Rect.Min.Y,
+			Width:  icon.Rect.Dx(),
+			Height: icon.Rect.Dy(),
+		})
+	}
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
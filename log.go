@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// logger carries every notice of the command. It starts out as plain text
+// at info level and is set up from -v, -q and -log-format once the flags
+// and config files are read.
+var logger = slog.New(&plainHandler{level: slog.LevelInfo, mu: new(sync.Mutex)})
+
+func setupLogger() {
+	level := slog.LevelInfo
+	switch {
+	case *quiet:
+		level = slog.LevelError
+	case *verbose:
+		level = slog.LevelDebug
+	case underGoGenerate():
+		level = slog.LevelError
+	}
+
+	switch *logFormat {
+	case "text":
+		logger = slog.New(&plainHandler{level: level, mu: new(sync.Mutex)})
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(stdoutWriter{}, &slog.HandlerOptions{Level: level}))
+	default:
+		logger.Error("invalid -log-format, expected text or json")
+		os.Exit(-1)
+	}
+}
+
+// log is the logger for the notices of t, naming the target when there
+// are several.
+func (t target) log() *slog.Logger {
+	if t.name == "" {
+		return logger
+	}
+	return logger.With("target", t.name)
+}
+
+// stdoutWriter writes to whatever os.Stdout is at the time, so -out - can
+// move the log to stderr after the logger was made.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// plainHandler writes one line per record the way the command always
+// printed its notices: the message, prefixed by the target and followed by
+// any other attributes as key=value.
+type plainHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var prefix, suffix strings.Builder
+	add := func(a slog.Attr) bool {
+		if a.Key == "target" {
+			prefix.WriteString(a.Value.String() + ": ")
+		} else {
+			fmt.Fprintf(&suffix, " %s=%v", a.Key, a.Value)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(add)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(stdoutWriter{}, "%s%s%s\n", prefix.String(), r.Message, suffix.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+// WithGroup is not used by the command, attributes stay unqualified.
+func (h *plainHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// progressMu keeps the bars of targets built side by side from tearing.
+var progressMu sync.Mutex
+
+// progressBar draws the spritify.Progress of t on stderr, redrawing one
+// line per stage and ending it once the stage is done.
+func progressBar(t target) func(spritify.Progress) {
+	prefix := ""
+	if t.name != "" {
+		prefix = t.name + ": "
+	}
+
+	return func(p spritify.Progress) {
+		const width = 30
+		filled := width * p.Done / p.Total
+
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		fmt.Fprintf(os.Stderr, "\r%s%-6s [%s%s] %d/%d", prefix, p.Stage, strings.Repeat("=", filled), strings.Repeat(" ", width-filled), p.Done, p.Total)
+		if p.Done == p.Total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// logStats logs a line per sheet and one for the whole build of t.
+func logStats(t target, stats spritify.Stats) {
+	for _, sheet := range stats.Sheets {
+		t.log().Info("sheet "+sheet.Filename, "size", fmt.Sprintf("%dx%d", sheet.Width, sheet.Height), "icons", sheet.Icons, "bytes", sheet.Bytes, "efficiency", percent(sheet.Efficiency))
+	}
+
+	args := []interface{}{"icons", stats.Icons, "sheets", len(stats.Sheets), "efficiency", percent(stats.Efficiency), "input_bytes", stats.InputBytes, "sprite_bytes", stats.SpriteBytes}
+	for _, phase := range stats.Phases {
+		args = append(args, phase.Stage, phase.Duration.Round(time.Microsecond))
+	}
+	t.log().Info("stats", args...)
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.1f%%", v*100)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// reloadScript reconnects to the event stream and reloads the page on every
+// rebuild. Server-sent events do the job of a websocket here without
+// anything outside the standard library.
+const reloadScript = `<script>new EventSource("/_reload").onmessage = function () { location.reload(); };</script>`
+
+// devServer serves the latest outputs of every target from memory and
+// tells connected demo pages when they changed.
+type devServer struct {
+	mu      sync.RWMutex
+	files   map[string][]byte
+	owners  map[string]string
+	clients map[chan struct{}]bool
+}
+
+func newDevServer() *devServer {
+	return &devServer{
+		files:   make(map[string][]byte),
+		owners:  make(map[string]string),
+		clients: make(map[chan struct{}]bool),
+	}
+}
+
+// rebuild regenerates t in memory, swaps in its outputs and notifies the
+// pages. Nothing is written to disk.
+func (s *devServer) rebuild(t target) error {
+	var files []spritify.File
+	var err error
+	if t.symbols {
+		_, files, err = generateSymbols(t)
+	} else {
+		_, files, err = generate(context.Background(), t)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, owner := range s.owners {
+		if owner == t.opts.Name {
+			delete(s.files, name)
+			delete(s.owners, name)
+		}
+	}
+	for _, f := range files {
+		if owner, ok := s.owners[f.Name]; ok {
+			return t.errorf(fmt.Errorf("%s is also generated by %s", f.Name, owner))
+		}
+		data := f.Data
+		if path.Ext(f.Name) == ".html" {
+			data = bytes.Replace(data, []byte("</body>"), []byte(reloadScript+"</body>"), 1)
+		}
+		s.files[f.Name] = data
+		s.owners[f.Name] = t.opts.Name
+	}
+
+	for client := range s.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+			// a reload is already pending for this page
+		}
+	}
+	return nil
+}
+
+func (s *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_reload" {
+		s.serveEvents(w, r)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	if r.URL.Path == "/" {
+		name = s.index()
+	}
+
+	s.mu.RLock()
+	data, ok := s.files[name]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// index picks the demo page served at /, the first in name order.
+func (s *devServer) index() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := ""
+	for name := range s.files {
+		if path.Ext(name) == ".html" && (index == "" || name < index) {
+			index = name
+		}
+	}
+	return index
+}
+
+func (s *devServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-client:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serve builds every target in memory, serves the outputs on addr and
+// rebuilds whenever a source directory changes.
+func serve(targets []target, addr string) {
+	srv := newDevServer()
+
+	go func() {
+		logger.Info(fmt.Sprintf("serving on http://%s/", addr))
+		if err := http.ListenAndServe(addr, srv); err != nil {
+			logger.Error(err.Error())
+			os.Exit(-1)
+		}
+	}()
+
+	watchSrc(targets, srv.rebuild)
+}
@@ -0,0 +1,166 @@
+package spritify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// Options.Animation values, what happens to the frames of an animated gif.
+const (
+	AnimationFirstFrame = "first-frame"
+	AnimationSkip       = "skip"
+	AnimationStrip      = "strip"
+)
+
+// Frame is one frame of an animated source packed as a strip.
+type Frame struct {
+	Rect  image.Rectangle // area of the frame relative to the icon's Rect.Min
+	Delay time.Duration   // how long the frame is shown
+}
+
+// decodeAnimation looks at the frames of p when it is a gif and Animation
+// cares about them. Only strips need them decoded, which happens unless
+// the run reads sizes only; otherwise anim is nil and the frames are only
+// counted. frames is 0 for any other file and with AnimationFirstFrame.
+func (g *Generator) decodeAnimation(p string) (frames int, anim *gif.GIF, err error) {
+	if g.opts.Animation == AnimationFirstFrame {
+		return 0, nil, nil
+	}
+
+	handler, err := g.open(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer handler.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(handler, magic); err != nil || !bytes.Equal(magic, []byte("GIF8")) {
+		// short files are left for the regular decoder to report
+		return 0, nil, nil
+	}
+	if _, err := handler.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, &DecodeError{p, err}
+	}
+
+	if g.opts.Animation != AnimationStrip || g.sizesOnly() {
+		// a broken file is left for the regular decoder to report too
+		frames, _ := countFrames(handler)
+		return frames, nil, nil
+	}
+	anim, err = gif.DecodeAll(handler)
+	if err != nil {
+		return 0, nil, &DecodeError{p, err}
+	}
+	return len(anim.Image), anim, nil
+}
+
+// countFrames counts the image descriptors of a gif without decompressing
+// any of them, stopping at the trailer or the first malformed block.
+func countFrames(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	// header and logical screen descriptor
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, err
+	}
+	if header[10]&0x80 != 0 {
+		if _, err := br.Discard(3 << (header[10]&7 + 1)); err != nil {
+			return 0, err
+		}
+	}
+
+	frames := 0
+	for {
+		introducer, err := br.ReadByte()
+		if err != nil {
+			return frames, err
+		}
+		switch introducer {
+		case 0x21: // extension, its label then data sub-blocks
+			if _, err := br.ReadByte(); err != nil {
+				return frames, err
+			}
+		case 0x2c: // image descriptor, local color table, lzw code size then data sub-blocks
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(br, descriptor); err != nil {
+				return frames, err
+			}
+			if descriptor[8]&0x80 != 0 {
+				if _, err := br.Discard(3 << (descriptor[8]&7 + 1)); err != nil {
+					return frames, err
+				}
+			}
+			if _, err := br.ReadByte(); err != nil {
+				return frames, err
+			}
+			frames++
+		case 0x3b: // trailer
+			return frames, nil
+		default:
+			return frames, fmt.Errorf("gif: unknown block 0x%02x", introducer)
+		}
+
+		for {
+			size, err := br.ReadByte()
+			if err != nil {
+				return frames, err
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := br.Discard(int(size)); err != nil {
+				return frames, err
+			}
+		}
+	}
+}
+
+// stripFrames renders every frame of anim onto its full canvas, applying
+// the disposal of the frame before, and lines them up left to right.
+func stripFrames(anim *gif.GIF) (*image.NRGBA, []Frame) {
+	size := image.Pt(anim.Config.Width, anim.Config.Height)
+	if size == image.ZP {
+		size = anim.Image[0].Bounds().Max
+	}
+
+	canvas := image.NewNRGBA(image.Rectangle{Max: size})
+	strip := image.NewNRGBA(image.Rect(0, 0, size.X*len(anim.Image), size.Y))
+	frames := make([]Frame, len(anim.Image))
+
+	for idx, frame := range anim.Image {
+		var disposal byte
+		if idx < len(anim.Disposal) {
+			disposal = anim.Disposal[idx]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		rect := image.Rect(idx*size.X, 0, (idx+1)*size.X, size.Y)
+		draw.Draw(strip, rect, canvas, image.ZP, draw.Src)
+		frames[idx].Rect = rect
+		if idx < len(anim.Delay) {
+			frames[idx].Delay = time.Duration(anim.Delay[idx]) * 10 * time.Millisecond
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.ZP, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return strip, frames
+}
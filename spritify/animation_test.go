@@ -0,0 +1,89 @@
+package spritify
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// animatedGIF encodes n frames of 8x6, each filled with its own color and
+// carrying a local palette.
+func animatedGIF(t *testing.T, n int) []byte {
+	t.Helper()
+	anim := &gif.GIF{}
+	for idx := 0; idx < n; idx++ {
+		palette := color.Palette{color.Transparent, color.RGBA{uint8(40 * idx), 0, 0xff, 0xff}}
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 6), palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = 1
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCountFrames(t *testing.T) {
+	for _, n := range []int{1, 2, 7} {
+		data := animatedGIF(t, n)
+		frames, err := countFrames(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%d frames: %v", n, err)
+		}
+		if frames != n {
+			t.Errorf("countFrames = %d, want %d", frames, n)
+		}
+	}
+}
+
+func TestAnimationModes(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "spin.gif"), animatedGIF(t, 3), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		animation string
+		dryRun    bool
+		icons     int
+		size      image.Point
+		warnings  int
+	}{
+		{"", false, 1, image.Pt(8, 6), 1},
+		{"", true, 1, image.Pt(8, 6), 1},
+		{AnimationFirstFrame, false, 1, image.Pt(8, 6), 0},
+		{AnimationSkip, false, 0, image.ZP, 0},
+		{AnimationSkip, true, 0, image.ZP, 0},
+		{AnimationStrip, false, 1, image.Pt(24, 6), 0},
+		{AnimationStrip, true, 1, image.Pt(24, 6), 0},
+	} {
+		opts := DefaultOptions()
+		opts.Src = src
+		opts.Extensions = []string{"gif"}
+		opts.Animation = test.animation
+		opts.DryRun = test.dryRun
+		opts.AllowEmpty = true
+		result, err := Generate(opts)
+		if err != nil {
+			t.Fatalf("%q dry run %v: %v", test.animation, test.dryRun, err)
+		}
+		if len(result.Icons) != test.icons {
+			t.Errorf("%q dry run %v: %d icons, want %d", test.animation, test.dryRun, len(result.Icons), test.icons)
+			continue
+		}
+		if test.icons > 0 && result.Icons[0].SourceSize != test.size {
+			t.Errorf("%q dry run %v: size %v, want %v", test.animation, test.dryRun, result.Icons[0].SourceSize, test.size)
+		}
+		if len(result.Warnings) != test.warnings {
+			t.Errorf("%q dry run %v: warnings %q, want %d", test.animation, test.dryRun, result.Warnings, test.warnings)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sheetBase is the file name of sheet without its extension, which the
+// per sheet atlas formats are named after.
+func sheetBase(sheet *Sheet) string {
+	return strings.TrimSuffix(sheet.Filename, filepath.Ext(sheet.Filename))
+}
+
+// Cocos2d renders a <sheet>.plist per sheet in the format 2 property list
+// of cocos2d and cocos2d-x, with the frames TexturePacker would give, so
+// SpriteFrameCache loads it as is.
+func (r *Result) Cocos2d() []File {
+	files := make([]File, 0, len(r.Sheets))
+	for _, sheet := range r.Sheets {
+		var buf bytes.Buffer
+		buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>frames</key>
+  <dict>
+`)
+		for _, icon := range sheet.Icons {
+			f := newTPFrame(icon)
+			// the offset is between the centers of the trimmed image and
+			// its source, with y pointing up
+			offsetX := float64(f.SpriteSourceSize.X) + float64(f.Frame.W)/2 - float64(f.SourceSize.W)/2
+			offsetY := float64(f.SourceSize.H)/2 - float64(f.SpriteSourceSize.Y) - float64(f.Frame.H)/2
+
+			fmt.Fprintf(&buf, "    <key>%s</key>\n    <dict>\n", xmlEscape(icon.Name))
+			fmt.Fprintf(&buf, "      <key>frame</key>\n      <string>{{%d,%d},{%d,%d}}</string>\n", f.Frame.X, f.Frame.Y, f.Frame.W, f.Frame.H)
+			fmt.Fprintf(&buf, "      <key>offset</key>\n      <string>{%s,%s}</string>\n", plistFloat(offsetX), plistFloat(offsetY))
+			buf.WriteString("      <key>rotated</key>\n      <false/>\n")
+			fmt.Fprintf(&buf, "      <key>sourceColorRect</key>\n      <string>{{%d,%d},{%d,%d}}</string>\n", f.SpriteSourceSize.X, f.SpriteSourceSize.Y, f.SpriteSourceSize.W, f.SpriteSourceSize.H)
+			fmt.Fprintf(&buf, "      <key>sourceSize</key>\n      <string>{%d,%d}</string>\n", f.SourceSize.W, f.SourceSize.H)
+			buf.WriteString("    </dict>\n")
+		}
+
+		b := sheet.Image.Bounds()
+		buf.WriteString("  </dict>\n  <key>metadata</key>\n  <dict>\n")
+		buf.WriteString("    <key>format</key>\n    <integer>2</integer>\n")
+		fmt.Fprintf(&buf, "    <key>realTextureFileName</key>\n    <string>%s</string>\n", xmlEscape(sheet.Filename))
+		fmt.Fprintf(&buf, "    <key>size</key>\n    <string>{%d,%d}</string>\n", b.Dx(), b.Dy())
+		fmt.Fprintf(&buf, "    <key>textureFileName</key>\n    <string>%s</string>\n", xmlEscape(sheet.Filename))
+		buf.WriteString("  </dict>\n</dict>\n</plist>\n")
+
+		files = append(files, File{sheetBase(sheet) + ".plist", buf.Bytes()})
+	}
+	return files
+}
+
+func plistFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
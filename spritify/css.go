@@ -0,0 +1,297 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// ClassName is the css class emitted for an icon, e.g. "icon-save-png",
+// rendered from Options.ClassTemplate.
+func (icon *Icon) ClassName() string {
+	return icon.Class
+}
+
+// classFuncs are available to Options.ClassTemplate.
+var classFuncs = template.FuncMap{
+	"slug":  classSlug,
+	"lower": strings.ToLower,
+}
+
+// classSlug replaces everything but letters, digits, '-' and '_' with '-',
+// so "arrow left.png" becomes "arrow-left-png".
+func classSlug(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+var cssIdent = regexp.MustCompile(`^-?[_\pL][-_\pL\pN]*$`)
+
+// Options.OnCollision values. Of the sources rendering the same class or
+// symbol id, the first by file name keeps it and the others are handled
+// this way.
+const (
+	CollisionError  = "error"  // fail the run
+	CollisionSuffix = "suffix" // append -2, -3, ... skipping classes other sources render
+	CollisionSkip   = "skip"   // leave the others out with a warning
+)
+
+// nameIcons renders the class of every icon, dropping those that collide
+// with CollisionSkip.
+func (g *Generator) nameIcons() error {
+	names := make([]string, len(g.icons))
+	classes := make([]string, len(g.icons))
+	for i, icon := range g.icons {
+		class, err := g.className(icon.Name)
+		if err != nil {
+			return err
+		}
+		names[i], classes[i] = icon.Name, class
+	}
+
+	classes, err := g.uniqueClasses("class", names, classes)
+	if err != nil {
+		return err
+	}
+
+	named := g.icons[:0]
+	for i, icon := range g.icons {
+		if classes[i] == "" {
+			continue
+		}
+		icon.Class = classes[i]
+		icon.Aliases = g.opts.Images[icon.Name].Aliases
+		named = append(named, icon)
+	}
+	g.icons = named
+	return nil
+}
+
+// uniqueClasses applies Options.OnCollision to classes, rendered for the
+// sources names in order, and returns the classes to use. A skipped source
+// gets "". What names the kind of class in messages.
+func (g *Generator) uniqueClasses(what string, names []string, classes []string) ([]string, error) {
+	owner := make(map[string]int, len(classes))
+	for i, class := range classes {
+		if _, ok := owner[class]; !ok {
+			owner[class] = i
+		}
+	}
+
+	unique := make([]string, len(classes))
+	for i, class := range classes {
+		first := owner[class]
+		if first == i {
+			unique[i] = class
+			continue
+		}
+
+		switch g.opts.OnCollision {
+		case CollisionSuffix:
+			for n := 2; ; n++ {
+				suffixed := fmt.Sprintf("%s-%d", class, n)
+				if _, ok := owner[suffixed]; !ok {
+					owner[suffixed] = i
+					unique[i] = suffixed
+					break
+				}
+			}
+		case CollisionSkip:
+			g.warn("%s: %s %q is taken by %s, skipping", names[i], what, class, names[first])
+		default:
+			return nil, fmt.Errorf("%s and %s both get the %s %q", names[first], names[i], what, class)
+		}
+	}
+	return unique, nil
+}
+
+// className renders Options.ClassTemplate for the source file name. Dir
+// and File split a name from a Recursive run, "ui/save.png" into "ui" and
+// "save.png".
+func (g *Generator) className(name string) (string, error) {
+	ext := path.Ext(name)
+	dir, file := path.Split(name)
+
+	var buf bytes.Buffer
+	err := g.class.Execute(&buf, struct {
+		Prefix string
+		Name   string
+		Base   string
+		Ext    string
+		Dir    string
+		File   string
+	}{g.opts.ClassPrefix, name, strings.TrimSuffix(name, ext), strings.TrimPrefix(ext, "."), strings.TrimSuffix(dir, "/"), file})
+	if err != nil {
+		return "", fmt.Errorf("class template: %v", err)
+	}
+
+	class := buf.String()
+	if !cssIdent.MatchString(class) {
+		return "", fmt.Errorf("class template gives %q for %s, which is not a valid css class", class, name)
+	}
+	return class, nil
+}
+
+// uniformSize reports whether every icon has the same dimensions, in which
+// case width and height are declared once on the shared .icon rule.
+func (r *Result) uniformSize() (image.Point, bool) {
+	if len(r.Icons) == 0 {
+		return image.ZP, false
+	}
+
+	size := r.Icons[0].Rect.Size()
+	for _, icon := range r.Icons[1:] {
+		if icon.Rect.Size() != size {
+			return image.ZP, false
+		}
+	}
+
+	return size, true
+}
+
+// backgroundPosition expresses the offset that shows box, a region of the
+// sheet, in an element of the same size, relative to the anchor corner.
+func (r *Result) backgroundPosition(box image.Rectangle, sheet image.Rectangle) string {
+	if r.opts.Anchor == AnchorBottomRight {
+		return fmt.Sprintf("right %dpx bottom %dpx", box.Max.X-sheet.Max.X, box.Max.Y-sheet.Max.Y)
+	}
+
+	return fmt.Sprintf("left %dpx top %dpx", -box.Min.X, -box.Min.Y)
+}
+
+// CSS renders the stylesheet: a shared .icon rule plus one rule per icon.
+func (r *Result) CSS() string {
+	cssBlocks := make([]string, 0, len(r.Icons)+1)
+
+	// with several sheets the url moves from the shared rule to each icon
+	background := `no-repeat`
+	if len(r.Sheets) == 1 {
+		background = fmt.Sprintf(`url("%s") no-repeat`, r.sheetURL(r.Sheets[0]))
+	}
+
+	pad := r.opts.Inset
+	size, uniform := r.uniformSize()
+	if uniform {
+		cssBlocks = append(cssBlocks, fmt.Sprintf(`.icon { background: %s; width:%dpx; height:%dpx;}`, background, size.X+2*pad, size.Y+2*pad))
+	} else {
+		cssBlocks = append(cssBlocks, fmt.Sprintf(`.icon { background: %s; }`, background))
+	}
+
+	for _, icon := range r.Icons {
+		sheet := r.Sheets[icon.Sheet].Image.Bounds()
+		bgImage := ""
+		if len(r.Sheets) > 1 && !r.opts.Embed {
+			bgImage = fmt.Sprintf(` background-image: url("%s");`, r.sheetURL(r.Sheets[icon.Sheet]))
+		}
+
+		box := icon.Rect.Inset(-pad)
+		if uniform {
+			cssBlocks = append(cssBlocks, fmt.Sprintf("%s {%s background-position: %s;}", icon.selector(""), bgImage, r.backgroundPosition(box, sheet)))
+		} else {
+			cssBlocks = append(cssBlocks, fmt.Sprintf("%s {%s background-position: %s; width:%dpx; height:%dpx;}", icon.selector(""), bgImage, r.backgroundPosition(box, sheet), box.Dx(), box.Dy()))
+		}
+
+		cssBlocks = append(cssBlocks, r.stateRules(icon, uniform)...)
+
+		if r.opts.CellAspect != image.ZP {
+			cssBlocks = append(cssBlocks, fmt.Sprintf("%s {%s background-position: %s; width:%dpx; height:%dpx;}", icon.selector("-cell"), bgImage, r.backgroundPosition(icon.Cell, sheet), icon.Cell.Dx(), icon.Cell.Dy()))
+		}
+	}
+
+	cssBlocks = append(cssBlocks, r.keyframesCSS()...)
+
+	// an embedded sheet is large, so it is given once for all of its icons
+	if len(r.Sheets) > 1 && r.opts.Embed {
+		for _, sheet := range r.Sheets {
+			cssBlocks = append(cssBlocks, fmt.Sprintf(`%s { background-image: url("%s");}`, r.sheetSelectors(sheet), r.sheetURL(sheet)))
+		}
+	}
+
+	if len(r.Retina) > 0 {
+		cssBlocks = append(cssBlocks, r.retinaCSS())
+	}
+	for _, set := range r.Scaled {
+		cssBlocks = append(cssBlocks, r.densityCSS(set.Density, set.Sheets))
+	}
+
+	return strings.Join(cssBlocks, "\n") + "\n"
+}
+
+// sheetSelectors lists the selector of every icon rule on sheet.
+func (r *Result) sheetSelectors(sheet *Sheet) string {
+	selectors := make([]string, 0, 2*len(sheet.Icons))
+	for _, icon := range sheet.Icons {
+		selectors = append(selectors, icon.selector(""))
+		if r.opts.CellAspect != image.ZP {
+			selectors = append(selectors, icon.selector("-cell"))
+		}
+	}
+	selectors = append(selectors, r.stateSelectorsOn(sheet)...)
+	for _, anim := range r.Animations {
+		if anim.Sheet == sheet.Index {
+			selectors = append(selectors, "."+anim.Class)
+		}
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// iconLabel turns a file name like "arrow_left.png" into "arrow left".
+func iconLabel(filename string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return strings.Join(strings.FieldsFunc(base, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ' '
+	}), " ")
+}
+
+// CSSFilename is the name the stylesheet is written under.
+func (r *Result) CSSFilename() string {
+	return r.opts.Name + ".css"
+}
+
+// DemoHTML renders a page showing every icon, linking the stylesheet from
+// CSSFilename.
+func (r *Result) DemoHTML() []byte {
+	divTags := make([]string, 0, len(r.Icons))
+	css := ""
+
+	for _, icon := range r.Icons {
+		divClass := icon.ClassName()
+		if r.opts.CellAspect != image.ZP {
+			divClass += "-cell"
+		}
+
+		if r.opts.DemoA11y {
+			label := html.EscapeString(iconLabel(icon.Name))
+			divTags = append(divTags, fmt.Sprintf(`<div class="icon %s" role="img" aria-label="%s"><span class="visually-hidden">%s</span></div>`, divClass, label, label))
+		} else {
+			divTags = append(divTags, fmt.Sprintf(`<div class="icon %s"></div>`, divClass))
+		}
+	}
+
+	for _, anim := range r.Animations {
+		divTags = append(divTags, fmt.Sprintf(`<div class="icon %s"></div>`, anim.Class))
+	}
+
+	if r.opts.DemoA11y {
+		css = ".visually-hidden { position:absolute; width:1px; height:1px; margin:-1px; padding:0; overflow:hidden; clip:rect(0 0 0 0); white-space:nowrap; border:0;}"
+	}
+
+	head := fmt.Sprintf(`<link rel="stylesheet" type="text/css" href="%s">`, html.EscapeString(r.CSSFilename()))
+	if css != "" {
+		head += fmt.Sprintf(`<style type="text/css">%s</style>`, css)
+	}
+
+	htmlTemplate := `<html><head>%s</head><body>%s</body></html>`
+	return []byte(fmt.Sprintf(htmlTemplate, head, strings.Join(divTags, "")))
+}
@@ -0,0 +1,39 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+)
+
+// DebugSVG draws the packing of sheet as labeled boxes over a faint copy of
+// the sprite, which is referenced by its relative filename.
+func (r *Result) DebugSVG(s *Sheet) []byte {
+	var buf bytes.Buffer
+	sheet := s.Image.Bounds()
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", sheet.Dx(), sheet.Dy(), sheet.Dx(), sheet.Dy())
+	fmt.Fprintf(&buf, `<image href="%s" x="0" y="0" width="%d" height="%d" opacity="0.35"/>`+"\n", xmlEscape(s.Filename), sheet.Dx(), sheet.Dy())
+	fmt.Fprintf(&buf, `<rect x="0.5" y="0.5" width="%d" height="%d" fill="none" stroke="#999" stroke-dasharray="2,2"/>`+"\n", sheet.Dx()-1, sheet.Dy()-1)
+
+	for _, i := range s.Icons {
+		b := i.Rect
+		if r.opts.CellAspect != image.ZP {
+			fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#09f" stroke-dasharray="3,1"/>`+"\n", i.Cell.Min.X, i.Cell.Min.Y, i.Cell.Dx(), i.Cell.Dy())
+		}
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="rgba(255,0,102,0.15)" stroke="#f06"><title>%s %dx%d @ %d,%d</title></rect>`+"\n",
+			b.Min.X, b.Min.Y, b.Dx(), b.Dy(), xmlEscape(i.Name), b.Dx(), b.Dy(), b.Min.X, b.Min.Y)
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" font-family="monospace" font-size="8" fill="#000">%s</text>`+"\n", b.Min.X+1, b.Min.Y+8, xmlEscape(i.Name))
+	}
+
+	buf.WriteString("</svg>\n")
+
+	return buf.Bytes()
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
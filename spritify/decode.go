@@ -0,0 +1,372 @@
+package spritify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Decoder decodes one image file.
+type Decoder func(io.Reader) (image.Image, error)
+
+var (
+	decodersLock sync.RWMutex
+
+	// decoders maps a lower-case file extension to its decoder; formats
+	// outside the standard library are added through RegisterDecoder.
+	decoders = map[string]Decoder{
+		".png": png.Decode,
+		".jpg": jpeg.Decode,
+		".gif": gif.Decode,
+	}
+)
+
+// Pool bounds how many images are decoded at once. A single Pool can be
+// shared by several Generators so concurrent runs split one budget.
+type Pool chan struct{}
+
+// NewPool returns a Pool that admits n decodes at a time.
+func NewPool(n int) Pool {
+	if n < 1 {
+		n = 1
+	}
+	return make(Pool, n)
+}
+
+func (p Pool) acquire() {
+	if p != nil {
+		p <- struct{}{}
+	}
+}
+
+func (p Pool) release() {
+	if p != nil {
+		<-p
+	}
+}
+
+// defaultExtensions are the formats DefaultOptions accepts, every built in
+// decoder for a common web format adds itself here.
+var defaultExtensions = []string{"jpg", "png"}
+
+// extAliases maps alternate spellings to the extension used for filtering
+// and decoder lookup.
+var extAliases = map[string]string{
+	"jpeg": "jpg",
+	"jpe":  "jpg",
+	"tif":  "tiff",
+}
+
+func canonicalExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if canonical, ok := extAliases[ext]; ok {
+		return canonical
+	}
+	return ext
+}
+
+// RegisterDecoder makes files with extension ext decodable, replacing any
+// decoder registered for it before. It is only consulted for content that
+// no format registered with image.RegisterFormat recognizes, so it suits
+// formats without magic bytes or with an external rasterizer such as svg.
+func RegisterDecoder(ext string, decoder Decoder) {
+	decodersLock.Lock()
+	decoders["."+canonicalExt(ext)] = decoder
+	decodersLock.Unlock()
+}
+
+func lookupDecoder(ext string) (Decoder, bool) {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+	decoder, ok := decoders[ext]
+	return decoder, ok
+}
+
+// readImages decodes paths with a pool of Jobs workers, each also holding
+// a slot of the shared Decoders pool while it decodes.
+func (g *Generator) readImages(paths []string) {
+	queue := make(chan string)
+	var workers sync.WaitGroup
+
+	for n := 0; n < g.opts.Jobs; n++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for p := range queue {
+				g.opts.Decoders.acquire()
+				g.safeReadImage(p)
+				g.opts.Decoders.release()
+				g.decoded(len(paths))
+			}
+		}()
+	}
+
+feed:
+	for _, p := range paths {
+		select {
+		case queue <- p:
+		case <-g.ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+
+	workers.Wait()
+}
+
+func (g *Generator) safeReadImage(p string) {
+	defer func() {
+		// a broken third party decoder must not take the run down
+		if err := recover(); err != nil {
+			g.fail(&DecodeError{p, fmt.Errorf("decoder panicked: %v", err)})
+		}
+	}()
+	g.readImage(p)
+}
+
+// readImage decodes p, or with LowMemory or a DryRun only its dimensions,
+// and adds it to the icons.
+func (g *Generator) readImage(p string) {
+	icon := &Icon{Name: g.iconName(p), path: p}
+
+	frames, anim, err := g.decodeAnimation(p)
+	if err != nil {
+		g.fail(err)
+		return
+	}
+	if frames > 1 {
+		switch g.opts.Animation {
+		case AnimationSkip:
+			return
+		case AnimationStrip:
+			strip, frames := stripFrames(anim)
+			icon.Source, icon.Frames = strip, frames
+			icon.SourceSize = strip.Bounds().Size()
+			g.mu.Lock()
+			g.icons = append(g.icons, icon)
+			g.mu.Unlock()
+			return
+		case "":
+			g.warn("%s: animated gif with %d frames, only the first is packed; see Animation", p, frames)
+		}
+	}
+
+	if g.sizesOnly() {
+		size, err := g.decodeSize(p)
+		if err != nil {
+			g.fail(err)
+			return
+		}
+		icon.SourceSize = size
+	} else if anim != nil {
+		// a strip of one frame, decoded already
+		g.checkExt(p, "."+canonicalExt(path.Ext(icon.Name)), "gif")
+		icon.Source = anim.Image[0]
+		icon.SourceSize = anim.Image[0].Bounds().Size()
+	} else {
+		img, err := g.decodeFile(p, true)
+		if err != nil {
+			g.fail(err)
+			return
+		}
+		icon.Source = img
+		icon.SourceSize = img.Bounds().Size()
+	}
+
+	g.mu.Lock()
+	g.icons = append(g.icons, icon)
+	g.mu.Unlock()
+}
+
+// decodeFile decodes p by its content when the format has registered itself
+// with image.RegisterFormat, as png, jpeg and gif do, warning when that
+// disagrees with the extension if asked to. Anything else goes to the
+// decoder registered for the extension.
+func (g *Generator) decodeFile(p string, warn bool) (image.Image, error) {
+	handler, err := g.open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer handler.Close()
+
+	ext := "." + canonicalExt(path.Ext(g.iconName(p)))
+	img, format, err := image.Decode(handler)
+	switch {
+	case err == nil:
+		if warn {
+			g.checkExt(p, ext, format)
+		}
+	case err == image.ErrFormat:
+		if _, err := handler.Seek(0, io.SeekStart); err != nil {
+			return nil, &DecodeError{p, err}
+		}
+		if img, err = g.decodeByExt(p, ext, handler); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &DecodeError{p, err}
+	}
+
+	if cmyk, ok := img.(*image.CMYK); ok {
+		img = cmykToNRGBA(cmyk)
+	}
+	return img, nil
+}
+
+// decodeSize reads the dimensions of p from its header where the format
+// allows it and decodes the whole file only for extension based decoders.
+func (g *Generator) decodeSize(p string) (image.Point, error) {
+	handler, err := g.open(p)
+	if err != nil {
+		return image.ZP, err
+	}
+	defer handler.Close()
+
+	ext := "." + canonicalExt(path.Ext(g.iconName(p)))
+	config, format, err := image.DecodeConfig(handler)
+	switch {
+	case err == nil:
+		g.checkExt(p, ext, format)
+		return image.Pt(config.Width, config.Height), nil
+	case err == image.ErrFormat:
+		if _, err := handler.Seek(0, io.SeekStart); err != nil {
+			return image.ZP, &DecodeError{p, err}
+		}
+		img, err := g.decodeByExt(p, ext, handler)
+		if err != nil {
+			return image.ZP, err
+		}
+		return img.Bounds().Size(), nil
+	default:
+		return image.ZP, &DecodeError{p, err}
+	}
+}
+
+func (g *Generator) checkExt(p string, ext string, format string) {
+	if ext != "."+canonicalExt(format) {
+		g.warn("%s: extension says %s but the content is %s, decoding it as %s", p, ext, format, format)
+	}
+}
+
+// errUnsupported is wrapped by the error for a source no decoder handles.
+// Such files are skipped with a warning, unlike those that are corrupt or
+// cannot be read.
+var errUnsupported = errors.New("not supported")
+
+// decodeByExt decodes r with the decoder Options.ExtDecoders has for ext,
+// or else the one registered for it.
+func (g *Generator) decodeByExt(p string, ext string, r io.Reader) (image.Image, error) {
+	decoder, ok := g.extDecoders[ext]
+	if !ok {
+		decoder, ok = lookupDecoder(ext)
+	}
+	if !ok {
+		switch ext {
+		case ".heic", ".heif":
+			return nil, &DecodeError{p, fmt.Errorf("HEIC/HEIF is %w, convert it to png or jpg first; skipping", errUnsupported)}
+		case ".svg":
+			return nil, &DecodeError{p, fmt.Errorf("svg is %w without a rasterizing decoder, see RegisterDecoder; skipping", errUnsupported)}
+		case ".webp":
+			return nil, &DecodeError{p, fmt.Errorf("WebP is %w in this build, rebuild with -tags webp; skipping", errUnsupported)}
+		default:
+			return nil, &DecodeError{p, fmt.Errorf("format %s is %w, skipping", ext, errUnsupported)}
+		}
+	}
+
+	img, err := decoder(r)
+	if err != nil {
+		return nil, &DecodeError{p, err}
+	}
+	return img, nil
+}
+
+// cmykToNRGBA applies the naive CMYK to RGB transform used by color.CMYK;
+// embedded ICC profiles are not interpreted.
+func cmykToNRGBA(cmyk *image.CMYK) *image.NRGBA {
+	b := cmyk.Bounds()
+	nrgba := image.NewNRGBA(b)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := cmyk.CMYKAt(x, y)
+			r, g, bl := color.CMYKToRGB(c.C, c.M, c.Y, c.K)
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: r, G: g, B: bl, A: 0xff})
+		}
+	}
+
+	return nrgba
+}
+
+// sourceFile is an opened source, seekable so that a second decoder can
+// start over.
+type sourceFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type bytesFile struct {
+	*bytes.Reader
+}
+
+func (bytesFile) Close() error { return nil }
+
+// open opens p on Options.FS, or the OS filesystem without one. Files of a
+// filesystem that cannot seek are read into memory.
+func (g *Generator) open(p string) (sourceFile, error) {
+	if remote, ok := g.fetched[p]; ok {
+		return bytesFile{bytes.NewReader(remote.data)}, nil
+	}
+	if g.opts.FS == nil {
+		handler, err := os.Open(p)
+		if err != nil {
+			return nil, &DecodeError{p, err}
+		}
+		return handler, nil
+	}
+
+	handler, err := g.opts.FS.Open(p)
+	if err != nil {
+		return nil, &DecodeError{p, err}
+	}
+	if seeker, ok := handler.(sourceFile); ok {
+		return seeker, nil
+	}
+	defer handler.Close()
+	data, err := io.ReadAll(handler)
+	if err != nil {
+		return nil, &DecodeError{p, err}
+	}
+	return bytesFile{bytes.NewReader(data)}, nil
+}
+
+// readFile reads p whole from Options.FS or the OS filesystem.
+func (g *Generator) readFile(p string) ([]byte, error) {
+	if remote, ok := g.fetched[p]; ok {
+		return remote.data, nil
+	}
+	if g.opts.FS == nil {
+		return os.ReadFile(p)
+	}
+	return fs.ReadFile(g.opts.FS, p)
+}
+
+// sizesOnly reports whether reading the dimensions of the sources is
+// enough: with LowMemory, and for a DryRun unless an option looks at pixels.
+func (g *Generator) sizesOnly() bool {
+	if g.opts.LowMemory {
+		return true
+	}
+	o := g.opts
+	return o.DryRun && !(o.Trim || o.Dedupe || o.Retina || len(o.Variants) > 0 || o.Resize != image.ZP || len(o.Densities) > 0 || o.Animation == AnimationStrip)
+}
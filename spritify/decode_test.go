@@ -0,0 +1,179 @@
+package spritify
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnsupportedFormatWarns(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "photo.heic"), []byte("not decodable here"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Src = src
+	opts.Extensions = []string{"heic"}
+	opts.Strict = true
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate failed on an unsupported format: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Errorf("Errors = %q, want none", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "photo.heic") {
+		t.Errorf("Warnings = %q, want one for photo.heic", result.Warnings)
+	}
+}
+
+func TestCorruptFileFails(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "broken.png"), []byte("\x89PNG\r\n\x1a\ntruncated"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Src = src
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("Errors = %q, want one for broken.png", result.Errors)
+	}
+}
+
+// testdata/cmyk.jpg is an Adobe CMYK jpeg of four flat 8x8 blocks: cyan,
+// magenta, yellow and 50% black.
+func TestCMYKToNRGBA(t *testing.T) {
+	handler, err := os.Open(filepath.Join("testdata", "cmyk.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	img, err := jpeg.Decode(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmyk, ok := img.(*image.CMYK)
+	if !ok {
+		t.Fatalf("decoded as %T, want *image.CMYK", img)
+	}
+
+	nrgba := cmykToNRGBA(cmyk)
+	if nrgba.Bounds() != cmyk.Bounds() {
+		t.Fatalf("bounds %v, want %v", nrgba.Bounds(), cmyk.Bounds())
+	}
+	for _, test := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{3, 4, color.NRGBA{0x00, 0xff, 0xff, 0xff}},
+		{8, 0, color.NRGBA{0xff, 0x00, 0xff, 0xff}},
+		{23, 7, color.NRGBA{0xff, 0xff, 0x00, 0xff}},
+		{28, 2, color.NRGBA{0x7f, 0x7f, 0x7f, 0xff}},
+	} {
+		if got := nrgba.NRGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel %d,%d = %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestDecodeFileConvertsCMYK(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cmyk.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "cmyk.jpg"), data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Src = src
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Icons[0].Source.(*image.NRGBA); !ok {
+		t.Errorf("cmyk source decoded as %T, want *image.NRGBA", result.Icons[0].Source)
+	}
+}
+
+func TestJPEGSpellings(t *testing.T) {
+	filter := extensionFilter(DefaultOptions().Extensions)
+	for _, name := range []string{"a.jpg", "b.jpeg", "c.JPG", "d.JPEG", "e.jpe"} {
+		if !filter.MatchString(name) {
+			t.Errorf("default extensions leave out %s", name)
+		}
+		if decoder, ok := lookupDecoder("." + canonicalExt(path.Ext(name))); !ok || decoder == nil {
+			t.Errorf("%s: no decoder for its extension", name)
+		}
+	}
+	if filter.MatchString("a.jpgx") {
+		t.Error("default extensions match a.jpgx")
+	}
+
+	src := t.TempDir()
+	for _, name := range []string{"lower.jpeg", "UPPER.JPG"} {
+		handler, err := os.Create(filepath.Join(src, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = jpeg.Encode(handler, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil)
+		if cerr := handler.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Src = src
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Icons) != 2 {
+		t.Errorf("packed %d icons, want 2", len(result.Icons))
+	}
+	// a mismatch between extension and content would be warned about
+	if len(result.Warnings) != 0 || len(result.Errors) != 0 {
+		t.Errorf("warnings %q, errors %q, want none", result.Warnings, result.Errors)
+	}
+}
+
+func TestExtDecodersPerGenerator(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "shape.svg"), []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sized := func(n int) Decoder {
+		return func(io.Reader) (image.Image, error) {
+			return image.NewNRGBA(image.Rect(0, 0, n, n)), nil
+		}
+	}
+
+	for _, n := range []int{16, 32} {
+		opts := DefaultOptions()
+		opts.Src = src
+		opts.Extensions = []string{"svg"}
+		opts.ExtDecoders = map[string]Decoder{"SVG": sized(n)}
+		result, err := Generate(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.Icons[0].SourceSize; got != image.Pt(n, n) {
+			t.Errorf("decoded at %v, want %dx%d", got, n, n)
+		}
+	}
+}
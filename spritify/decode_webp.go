@@ -0,0 +1,12 @@
+//go:build webp
+
+package spritify
+
+import "golang.org/x/image/webp"
+
+// WebP lives outside the standard library, so it is only compiled in with
+// `go build -tags webp`; it then joins the default extensions as well.
+func init() {
+	RegisterDecoder("webp", webp.Decode)
+	defaultExtensions = append(defaultExtensions, "webp")
+}
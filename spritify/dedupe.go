@@ -0,0 +1,93 @@
+package spritify
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// pixelHash identifies an image by its size and NRGBA pixels, so files in
+// different formats still match when they decode to the same bitmap.
+func pixelHash(img image.Image) [sha256.Size]byte {
+	b := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != image.ZP || nrgba.Stride != 4*b.Dx() {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(nrgba, nrgba.Rect, img, b.Min, draw.Src)
+	}
+
+	h := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint32(size[:4], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(size[4:], uint32(b.Dy()))
+	h.Write(size[:])
+	h.Write(nrgba.Pix[:4*b.Dx()*b.Dy()])
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// dedupeIcons takes every icon whose pixels match an earlier one out of
+// g.icons and marks it with DuplicateOf. The icons arrive sorted by name, so
+// the first name in alphabetical order is the one that gets packed.
+func (g *Generator) dedupeIcons() {
+	seen := make(map[[sha256.Size]byte]*Icon)
+
+	icons := make([]*Icon, 0, len(g.icons))
+	for _, icon := range g.icons {
+		sum := pixelHash(icon.Source)
+		if original, ok := seen[sum]; ok {
+			icon.DuplicateOf = original
+			g.duplicates = append(g.duplicates, icon)
+			continue
+		}
+		seen[sum] = icon
+		icons = append(icons, icon)
+	}
+	g.icons = icons
+}
+
+// resolveDuplicates gives every duplicate the placement of its original and
+// lists it right after the original in the sheets and the result.
+func (g *Generator) resolveDuplicates(result *Result) {
+	if len(g.duplicates) == 0 {
+		return
+	}
+
+	copies := make(map[*Icon][]*Icon)
+	for _, icon := range g.duplicates {
+		original := icon.DuplicateOf
+		icon.Sheet = original.Sheet
+		icon.Rect = original.Rect
+		icon.Cell = original.Cell
+		icon.TrimOffset = original.TrimOffset
+		icon.Source = original.Source
+		icon.Retina = original.Retina
+		icon.dense = original.dense
+		copies[original] = append(copies[original], icon)
+	}
+
+	withCopies := func(icons []*Icon) []*Icon {
+		merged := make([]*Icon, 0, len(icons))
+		for _, icon := range icons {
+			merged = append(merged, icon)
+			merged = append(merged, copies[icon]...)
+		}
+		return merged
+	}
+
+	for _, sheet := range result.Sheets {
+		sheet.Icons = withCopies(sheet.Icons)
+	}
+	for _, sheet := range result.Retina {
+		sheet.Icons = withCopies(sheet.Icons)
+	}
+	for _, set := range result.Scaled {
+		for _, sheet := range set.Sheets {
+			sheet.Icons = withCopies(sheet.Icons)
+		}
+	}
+	result.Icons = withCopies(result.Icons)
+}
@@ -0,0 +1,86 @@
+package spritify
+
+import (
+	"image"
+)
+
+// DensitySheets are the copies of Result.Sheets at one pixel density.
+type DensitySheets struct {
+	Density int
+	Sheets  []*Sheet // index for index with Result.Sheets
+}
+
+// maxDensity is the density the sources are drawn at, 1 without
+// Options.Densities.
+func (g *Generator) maxDensity() int {
+	max := 1
+	for _, d := range g.opts.Densities {
+		max = maxInt(max, d)
+	}
+	return max
+}
+
+// downscaleIcons keeps the full resolution source of every icon for the
+// high density sheets and packs a copy scaled down to 1x.
+func (g *Generator) downscaleIcons() {
+	max := g.maxDensity()
+	for _, icon := range g.icons {
+		size := icon.Source.Bounds().Size()
+		icon.dense = icon.Source
+		icon.Source = g.resample(icon.Source, scaledSize(size, 1/float64(max)))
+		icon.SourceSize = icon.Source.Bounds().Size()
+	}
+}
+
+// trimDense crops the full resolution source to the area kept by trimming
+// the 1x one, scaled by the ratio of their sizes.
+func trimDense(icon *Icon) {
+	size := icon.Source.Bounds().Size()
+	sub, ok := icon.dense.(subImager)
+	if !ok || size == icon.SourceSize {
+		return
+	}
+
+	b := icon.dense.Bounds()
+	scale := func(v, full, dense int) int { return v * dense / full }
+	crop := image.Rect(
+		scale(icon.TrimOffset.X, icon.SourceSize.X, b.Dx()),
+		scale(icon.TrimOffset.Y, icon.SourceSize.Y, b.Dy()),
+		scale(icon.TrimOffset.X+size.X, icon.SourceSize.X, b.Dx()),
+		scale(icon.TrimOffset.Y+size.Y, icon.SourceSize.Y, b.Dy()),
+	)
+	icon.dense = sub.SubImage(crop.Add(b.Min))
+}
+
+// densitySheets renders the sheets of every density above 1, resampling
+// the full resolution sources unless they already have the exact size, and
+// reports each as encoded out of encodeTotal.
+func (g *Generator) densitySheets(sheets []*Sheet, encodeTotal int) ([]DensitySheets, error) {
+	var all []DensitySheets
+	for _, density := range g.opts.Densities {
+		if density == 1 {
+			continue
+		}
+
+		set := DensitySheets{Density: density}
+		for _, sheet := range sheets {
+			if err := g.ctx.Err(); err != nil {
+				return nil, err
+			}
+			scaled, err := g.scaledSheet(sheet, density, func(icon *Icon) image.Image {
+				size := icon.Rect.Size().Mul(density)
+				if icon.dense.Bounds().Size() == size {
+					return icon.dense
+				}
+				return g.resample(icon.dense, size)
+			})
+			if err != nil {
+				return nil, err
+			}
+			set.Sheets = append(set.Sheets, scaled)
+			g.encoded(encodeTotal)
+		}
+		all = append(all, set)
+	}
+	return all, nil
+}
@@ -0,0 +1,126 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync"
+)
+
+// Encoder writes a finished sheet in one output format.
+type Encoder func(w io.Writer, img image.Image) error
+
+var (
+	encodersLock sync.RWMutex
+
+	// encoders maps an Options.OutputFormat value, which is also the file
+	// extension of the sheets, to its encoder. The standard library only
+	// encodes png and jpeg; webp, avif and others are added through
+	// RegisterEncoder.
+	encoders = map[string]Encoder{
+		"png":  pngEncoder(png.DefaultCompression),
+		"jpeg": jpegEncoder(defaultJPEGQuality),
+		"jpg":  jpegEncoder(defaultJPEGQuality),
+	}
+)
+
+const defaultJPEGQuality = 90
+
+// opaqueFormats cannot store transparency, their sheets are filled white
+// unless Options.Background says otherwise.
+var opaqueFormats = map[string]bool{"jpeg": true, "jpg": true}
+
+func jpegEncoder(quality int) Encoder {
+	return func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+}
+
+// sheetMIME is the media type of a sheet in format, for data uris.
+func sheetMIME(format string) string {
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	return "image/" + format
+}
+
+// RegisterEncoder makes format usable as Options.OutputFormat, replacing any
+// encoder registered for it before.
+func RegisterEncoder(format string, encoder Encoder) {
+	encodersLock.Lock()
+	encoders[format] = encoder
+	encodersLock.Unlock()
+}
+
+func lookupEncoder(format string) (Encoder, bool) {
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+	encoder, ok := encoders[format]
+	return encoder, ok
+}
+
+// pngBuffers lets every png encode reuse the compression buffers of the
+// previous ones, which adds up over the rebuilds of a long running process.
+var pngBuffers = &bufferPool{}
+
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func (p *bufferPool) Get() *png.EncoderBuffer {
+	buf, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buf
+}
+
+func (p *bufferPool) Put(buf *png.EncoderBuffer) {
+	p.pool.Put(buf)
+}
+
+// pngEncoder writes pngs at the given compression level with only the
+// essential chunks.
+func pngEncoder(level png.CompressionLevel) Encoder {
+	encoder := &png.Encoder{CompressionLevel: level, BufferPool: pngBuffers}
+	return func(w io.Writer, img image.Image) error {
+		var encoded bytes.Buffer
+		if err := encoder.Encode(&encoded, img); err != nil {
+			return err
+		}
+		return stripPNG(w, encoded.Bytes(), nil)
+	}
+}
+
+// encodeStrippedPNG writes img as a png with only the essential chunks at
+// the default compression.
+func encodeStrippedPNG(w io.Writer, img image.Image) error {
+	return pngEncoder(png.DefaultCompression)(w, img)
+}
+
+func (g *Generator) encodeSheet(nrgba *image.NRGBA) ([]byte, error) {
+	var img image.Image = nrgba
+	if g.opts.Quantize > 0 {
+		img = quantize(nrgba, g.opts.Quantize, g.opts.Dither)
+	}
+
+	var buf bytes.Buffer
+	if err := g.encoder(&buf, img); err != nil {
+		return nil, err
+	}
+	if g.opts.Optimize == nil {
+		return buf.Bytes(), nil
+	}
+
+	optimized, err := g.opts.Optimize(buf.Bytes())
+	if err != nil || g.opts.OutputFormat != "png" {
+		return optimized, err
+	}
+	// optimizers like to add tIME or tEXt chunks, which would make the
+	// bytes depend on when and by what the sheet was built
+	var stripped bytes.Buffer
+	if err := stripPNG(&stripped, optimized, g.keepChunks); err != nil {
+		return nil, fmt.Errorf("optimized sheet: %v", err)
+	}
+	return stripped.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package spritify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Unity renders <sheet>.meta for every sheet: import settings that slice
+// the sheet into one sprite per icon, named like the script outputs. The
+// guid is derived from Name and the sheet file, so it stays the same from
+// build to build and references to the sprites survive a rebuild.
+func (r *Result) Unity() []File {
+	names := r.moduleNames()
+	index := make(map[*Icon]int, len(r.Icons))
+	for idx, icon := range r.Icons {
+		index[icon] = idx
+	}
+
+	files := make([]File, 0, len(r.Sheets))
+	for _, sheet := range r.Sheets {
+		guid := sha256.Sum256([]byte(r.opts.Name + "/" + sheet.Filename))
+		height := sheet.Image.Bounds().Dy()
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "fileFormatVersion: 2\nguid: %s\nTextureImporter:\n", hex.EncodeToString(guid[:16]))
+		buf.WriteString("  serializedVersion: 12\n  textureType: 8\n  spriteMode: 2\n  alphaIsTransparency: 1\n  spritePixelsToUnits: 100\n")
+		buf.WriteString("  spriteSheet:\n    serializedVersion: 2\n    sprites:\n")
+		for _, icon := range sheet.Icons {
+			// unity counts y from the bottom of the texture
+			fmt.Fprintf(&buf, "    - serializedVersion: 2\n      name: %s\n", jsString(names[index[icon]]))
+			fmt.Fprintf(&buf, "      rect:\n        serializedVersion: 2\n        x: %d\n        y: %d\n        width: %d\n        height: %d\n",
+				icon.Rect.Min.X, height-icon.Rect.Max.Y, icon.Rect.Dx(), icon.Rect.Dy())
+			buf.WriteString("      alignment: 0\n      pivot: {x: 0.5, y: 0.5}\n      border: {x: 0, y: 0, z: 0, w: 0}\n")
+		}
+		buf.WriteString("  userData:\n  assetBundleName:\n  assetBundleVariant:\n")
+
+		files = append(files, File{sheet.Filename + ".meta", buf.Bytes()})
+	}
+	return files
+}
+
+// Godot renders an AtlasTexture resource per icon, <name>.<class>.tres,
+// showing its region of the sheet. The sheet is referenced relative to the
+// resource, so both are kept in the same directory of the project.
+func (r *Result) Godot() []File {
+	files := make([]File, 0, len(r.Icons))
+	for _, icon := range r.Icons {
+		var buf bytes.Buffer
+		buf.WriteString("[gd_resource type=\"AtlasTexture\" load_steps=2 format=3]\n\n")
+		fmt.Fprintf(&buf, "[ext_resource type=\"Texture2D\" path=%s id=\"1\"]\n\n", jsString(r.Sheets[icon.Sheet].Filename))
+		fmt.Fprintf(&buf, "[resource]\natlas = ExtResource(\"1\")\nregion = Rect2(%d, %d, %d, %d)\n",
+			icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy())
+
+		files = append(files, File{r.opts.Name + "." + icon.ClassName() + ".tres", buf.Bytes()})
+	}
+	return files
+}
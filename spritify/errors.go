@@ -0,0 +1,63 @@
+package spritify
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrNoImages is returned by Generate and GenerateSymbols when no file under
+// Src matches, unless Options.AllowEmpty asks for an empty sprite.
+var ErrNoImages = errors.New("no images found")
+
+// DecodeError reports a source file that could not be opened or decoded.
+// Generate leaves such files out and lists them in Result.Errors, or with
+// Strict fails with an error wrapping every DecodeError.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string { return pathError(e.Path, e.Err) }
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// OptionsError reports Options that NewGenerator rejects.
+type OptionsError struct {
+	Err error
+}
+
+func (e *OptionsError) Error() string { return e.Err.Error() }
+
+func (e *OptionsError) Unwrap() error { return e.Err }
+
+// WriteError reports an output that could not be written, Name being the
+// name of the File.
+type WriteError struct {
+	Name string
+	Err  error
+}
+
+func (e *WriteError) Error() string { return pathError(e.Name, e.Err) }
+
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// pathError prefixes err with name unless it is an fs.PathError, which
+// names the file already.
+func pathError(name string, err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return err.Error()
+	}
+	return name + ": " + err.Error()
+}
+
+// readErrors is the error of a Strict run, with the message listing every
+// file and unwrapping to their DecodeErrors for errors.As.
+type readErrors struct {
+	msg  string
+	errs []error
+}
+
+func (e *readErrors) Error() string { return e.msg }
+
+func (e *readErrors) Unwrap() []error { return e.errs }
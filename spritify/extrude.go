@@ -0,0 +1,42 @@
+package spritify
+
+import "image"
+
+// extrude repeats the outermost pixels of every icon n times into the
+// margin around it, so filtering at the icon's edge samples its own colors
+// rather than the neighbour's or the transparent gap.
+func extrude(nrgba *image.NRGBA, icons []*Icon, n int) {
+	for _, icon := range icons {
+		r := icon.Rect
+		if r.Empty() {
+			continue
+		}
+
+		// rows first, then whole columns including the new rows, which
+		// fills the corners with the corner pixels
+		for k := 1; k <= n; k++ {
+			copyRow(nrgba, r.Min.X, r.Max.X, r.Min.Y, r.Min.Y-k)
+			copyRow(nrgba, r.Min.X, r.Max.X, r.Max.Y-1, r.Max.Y-1+k)
+		}
+		for y := r.Min.Y - n; y < r.Max.Y+n; y++ {
+			for k := 1; k <= n; k++ {
+				copyPixel(nrgba, r.Min.X, y, r.Min.X-k, y)
+				copyPixel(nrgba, r.Max.X-1, y, r.Max.X-1+k, y)
+			}
+		}
+	}
+}
+
+func copyRow(nrgba *image.NRGBA, x0, x1, from, to int) {
+	if !image.Pt(x0, to).In(nrgba.Rect) || !image.Pt(x1-1, to).In(nrgba.Rect) {
+		return
+	}
+	copy(nrgba.Pix[nrgba.PixOffset(x0, to):nrgba.PixOffset(x1, to)], nrgba.Pix[nrgba.PixOffset(x0, from):nrgba.PixOffset(x1, from)])
+}
+
+func copyPixel(nrgba *image.NRGBA, fromX, fromY, toX, toY int) {
+	if !image.Pt(toX, toY).In(nrgba.Rect) || !image.Pt(fromX, fromY).In(nrgba.Rect) {
+		return
+	}
+	copy(nrgba.Pix[nrgba.PixOffset(toX, toY):nrgba.PixOffset(toX, toY)+4], nrgba.Pix[nrgba.PixOffset(fromX, fromY):])
+}
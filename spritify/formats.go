@@ -0,0 +1,54 @@
+package spritify
+
+import (
+	"fmt"
+	"sort"
+)
+
+// formatRenderer renders the files of one Options.Formats entry.
+type formatRenderer func(r *Result) ([]File, error)
+
+var formatRenderers = map[string]formatRenderer{
+	"scss":                styleSheetFormat("scss"),
+	"less":                styleSheetFormat("less"),
+	"texturepacker-hash":  func(r *Result) ([]File, error) { return r.texturePacker(false) },
+	"texturepacker-array": func(r *Result) ([]File, error) { return r.texturePacker(true) },
+	"typescript":          func(r *Result) ([]File, error) { return r.TypeScript(), nil },
+	"react":               func(r *Result) ([]File, error) { return []File{r.React()}, nil },
+	"webcomponent":        func(r *Result) ([]File, error) { return []File{r.WebComponent()}, nil },
+	"go":                  func(r *Result) ([]File, error) { return r.GoSource() },
+	"unity":               func(r *Result) ([]File, error) { return r.Unity(), nil },
+	"godot":               func(r *Result) ([]File, error) { return r.Godot(), nil },
+	"cocos2d":             func(r *Result) ([]File, error) { return r.Cocos2d(), nil },
+	"starling":            func(r *Result) ([]File, error) { return r.Starling(), nil },
+	"phaser":              func(r *Result) ([]File, error) { return r.Phaser() },
+}
+
+// FormatNames lists the values accepted in Options.Formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(formatRenderers))
+	for name := range formatRenderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format renders the files produced by one Options.Formats value.
+func (r *Result) Format(name string) ([]File, error) {
+	render, ok := formatRenderers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+	return render(r)
+}
+
+func styleSheetFormat(format string) formatRenderer {
+	return func(r *Result) ([]File, error) {
+		data, err := r.StyleSheet(format)
+		if err != nil {
+			return nil, err
+		}
+		return []File{{r.opts.Name + "." + format, data}}, nil
+	}
+}
@@ -0,0 +1,58 @@
+package spritify
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata/golden")
+
+// TestGolden builds testdata/golden/src with the default options and
+// compares the sheet, the stylesheet and the manifest byte for byte with
+// the files next to it. Run go test -run TestGolden -update after an
+// intended change to the outputs.
+func TestGolden(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Src = filepath.Join("testdata", "golden", "src")
+	opts.Manifest = true
+
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := result.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := make(map[string][]byte, len(files))
+	for _, f := range files {
+		generated[f.Name] = f.Data
+	}
+
+	for _, name := range []string{"sprite.png", "sprite.css", "sprite.json"} {
+		data, ok := generated[name]
+		if !ok {
+			t.Errorf("%s was not generated", name)
+			continue
+		}
+
+		golden := filepath.Join("testdata", "golden", name)
+		if *update {
+			if err := os.WriteFile(golden, data, 0666); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s differs from %s, run go test -run TestGolden -update if that is intended", name, golden)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+)
+
+// goPackage is the package clause of GoSource: Options.GoPackage, or the
+// Name lowercased when that is a valid one.
+func (r *Result) goPackage() string {
+	if r.opts.GoPackage != "" {
+		return r.opts.GoPackage
+	}
+	if name := strings.ToLower(r.opts.Name); token.IsIdentifier(name) {
+		return name
+	}
+	return "sprite"
+}
+
+// GoSource renders <name>.go, declaring the sheet files and the rectangle
+// of every icon by the names of the script outputs, for Go programs that
+// draw from the sheets at runtime. It is meant to be kept up to date by
+// go:generate.
+func (r *Result) GoSource() ([]File, error) {
+	names := r.moduleNames()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gospritifulcss; DO NOT EDIT.\n\npackage %s\n\nimport \"image\"\n\n", r.goPackage())
+
+	buf.WriteString("// Sheets are the files of the sheets, in the output directory.\nvar Sheets = []string{\n")
+	for _, sheet := range r.Sheets {
+		fmt.Fprintf(&buf, "%q,\n", sheet.Filename)
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// Icons are the rectangles of the icons on their sheet.\nvar Icons = map[string]image.Rectangle{\n")
+	for idx, icon := range r.Icons {
+		fmt.Fprintf(&buf, "%q: image.Rect(%d, %d, %d, %d),\n", names[idx], icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Max.X, icon.Rect.Max.Y)
+	}
+	buf.WriteString("}\n")
+
+	if len(r.Sheets) > 1 {
+		buf.WriteString("\n// IconSheets are the indexes into Sheets of the icons.\nvar IconSheets = map[string]int{\n")
+		for idx, icon := range r.Icons {
+			fmt.Fprintf(&buf, "%q: %d,\n", names[idx], icon.Sheet)
+		}
+		buf.WriteString("}\n")
+	}
+
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("go format: %v", err)
+	}
+	return []File{{r.opts.Name + ".go", data}}, nil
+}
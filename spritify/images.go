@@ -0,0 +1,63 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// ImageOptions override the global options for one source file, see
+// Options.Images.
+type ImageOptions struct {
+	Padding  int          // transparent space kept around this image on top of the gap
+	NoTrim   bool         // keep the transparent borders of this image with Trim
+	Position *image.Point // fixed top-left corner of the image in its sheet, nil to pack it
+	Aliases  []string     // further class names sharing the rule of this image
+}
+
+// String renders o with the position it points at, for hashing options.
+func (o ImageOptions) String() string {
+	position := "nil"
+	if o.Position != nil {
+		position = o.Position.String()
+	}
+	return fmt.Sprintf("{padding=%d notrim=%v position=%s aliases=%q}", o.Padding, o.NoTrim, position, o.Aliases)
+}
+
+// imagePadding is the extra padding of icon from Options.Images.
+func (g *Generator) imagePadding(icon *Icon) int {
+	return g.opts.Images[icon.Name].Padding
+}
+
+// fixedRegions turns the positions of Options.Images into regions, as if
+// the images had been there in a previous build.
+func (g *Generator) fixedRegions(icons []*Icon) map[string]image.Rectangle {
+	fixed := make(map[string]image.Rectangle)
+	for _, icon := range icons {
+		if pos := g.opts.Images[icon.Name].Position; pos != nil {
+			fixed[icon.Name] = image.Rectangle{Min: *pos, Max: pos.Add(icon.size())}
+		}
+	}
+	return fixed
+}
+
+// hasFixed reports whether any image of Options.Images has a position.
+func (g *Generator) hasFixed() bool {
+	for _, o := range g.opts.Images {
+		if o.Position != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selector lists the class of icon and its aliases, each followed by
+// suffix, e.g. ".icon-save-png:hover, .floppy:hover".
+func (icon *Icon) selector(suffix string) string {
+	selectors := make([]string, 0, 1+len(icon.Aliases))
+	selectors = append(selectors, "."+icon.ClassName()+suffix)
+	for _, alias := range icon.Aliases {
+		selectors = append(selectors, "."+alias+suffix)
+	}
+	return strings.Join(selectors, ", ")
+}
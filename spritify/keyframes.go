@@ -0,0 +1,175 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFPS is the frame rate of numbered sequences when Options.FPS is 0.
+const defaultFPS = 12
+
+// Animation is a css keyframe animation stepping through packed frames,
+// from a numbered sequence such as walk_001.png, walk_002.png or from the
+// frames of an animated gif.
+type Animation struct {
+	Name   string // e.g. "walk"
+	Class  string // "anim-" and the slug of Name
+	Sheet  int    // index into Result.Sheets holding every frame
+	Frames []AnimationFrame
+}
+
+// AnimationFrame is one step of an Animation.
+type AnimationFrame struct {
+	Rect  image.Rectangle // area of the frame in the sheet
+	Delay time.Duration   // how long the frame is shown
+}
+
+// Duration is how long one loop of the animation takes.
+func (a *Animation) Duration() time.Duration {
+	var total time.Duration
+	for _, frame := range a.Frames {
+		total += frame.Delay
+	}
+	return total
+}
+
+// sequenceName matches the base name of a numbered frame, e.g. walk_001.
+var sequenceName = regexp.MustCompile(`^(.+)[_-](\d+)$`)
+
+// animations finds the numbered sequences and gif strips among the packed
+// icons. Sequences whose frames differ in size or are spread over several
+// sheets cannot be expressed as one background and are left out with a
+// warning.
+func (g *Generator) animations(icons []*Icon) []*Animation {
+	type numbered struct {
+		icon   *Icon
+		number int
+	}
+	sequences := make(map[string][]numbered)
+	var names []string
+	var strips []*Icon
+
+	for _, icon := range icons {
+		if icon.Frames != nil {
+			strips = append(strips, icon)
+			continue
+		}
+		match := sequenceName.FindStringSubmatch(iconKey(icon.Name))
+		if match == nil {
+			continue
+		}
+		number, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		if _, ok := sequences[match[1]]; !ok {
+			names = append(names, match[1])
+		}
+		sequences[match[1]] = append(sequences[match[1]], numbered{icon, number})
+	}
+
+	fps := g.opts.FPS
+	if fps == 0 {
+		fps = defaultFPS
+	}
+	delay := time.Second / time.Duration(fps)
+
+	var anims []*Animation
+	seen := make(map[string]bool)
+	add := func(anim *Animation) {
+		if seen[anim.Class] {
+			g.warn("animation %s: another sequence has the same name, only the first is kept", anim.Name)
+			return
+		}
+		seen[anim.Class] = true
+		anims = append(anims, anim)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		frames := sequences[name]
+		if len(frames) < 2 {
+			continue
+		}
+		sort.SliceStable(frames, func(a, b int) bool { return frames[a].number < frames[b].number })
+
+		anim := &Animation{Name: name, Class: "anim-" + classSlug(name), Sheet: frames[0].icon.Sheet}
+		size := frames[0].icon.Rect.Size()
+		for _, frame := range frames {
+			if frame.icon.Sheet != anim.Sheet {
+				g.warn("animation %s: %s is on another sheet than the first frame, not animated", name, frame.icon.Name)
+				anim = nil
+				break
+			}
+			if frame.icon.Rect.Size() != size {
+				g.warn("animation %s: %s differs in size from the first frame, not animated", name, frame.icon.Name)
+				anim = nil
+				break
+			}
+			anim.Frames = append(anim.Frames, AnimationFrame{Rect: frame.icon.Rect, Delay: delay})
+		}
+		if anim != nil {
+			add(anim)
+		}
+	}
+
+	for _, icon := range strips {
+		name := iconKey(icon.Name)
+		anim := &Animation{Name: name, Class: "anim-" + classSlug(name), Sheet: icon.Sheet}
+		for _, frame := range icon.Frames {
+			if frame.Delay <= 0 {
+				// browsers show frames without a delay for 100ms as well
+				frame.Delay = 100 * time.Millisecond
+			}
+			anim.Frames = append(anim.Frames, AnimationFrame{Rect: frame.Rect.Add(icon.Rect.Min), Delay: frame.Delay})
+		}
+		add(anim)
+	}
+
+	return anims
+}
+
+// keyframesCSS renders the @keyframes rule and the class of every
+// animation. The frames are held with step-end, so each background
+// position is shown for its delay without sliding to the next.
+func (r *Result) keyframesCSS() []string {
+	pad := r.opts.Inset
+	blocks := make([]string, 0, 2*len(r.Animations))
+
+	for _, anim := range r.Animations {
+		sheet := r.Sheets[anim.Sheet]
+		total := anim.Duration()
+
+		var steps []string
+		var elapsed time.Duration
+		for _, frame := range anim.Frames {
+			steps = append(steps, fmt.Sprintf("%s%% { background-position: %s; }", percent(elapsed, total), r.backgroundPosition(frame.Rect.Inset(-pad), sheet.Image.Bounds())))
+			elapsed += frame.Delay
+		}
+		last := anim.Frames[len(anim.Frames)-1].Rect.Inset(-pad)
+		steps = append(steps, fmt.Sprintf("100%% { background-position: %s; }", r.backgroundPosition(last, sheet.Image.Bounds())))
+		blocks = append(blocks, fmt.Sprintf("@keyframes %s { %s }", anim.Class, strings.Join(steps, " ")))
+
+		bgImage := ""
+		if len(r.Sheets) > 1 && !r.opts.Embed {
+			bgImage = fmt.Sprintf(` background-image: url("%s");`, r.sheetURL(sheet))
+		}
+		first := anim.Frames[0].Rect.Inset(-pad)
+		blocks = append(blocks, fmt.Sprintf(".%s {%s background-position: %s; width:%dpx; height:%dpx; animation: %s %gs step-end infinite;}",
+			anim.Class, bgImage, r.backgroundPosition(first, sheet.Image.Bounds()), first.Dx(), first.Dy(), anim.Class, total.Seconds()))
+	}
+
+	return blocks
+}
+
+// percent is the share of total that elapsed is, to three decimals.
+func percent(elapsed, total time.Duration) string {
+	p := math.Round(float64(elapsed)/float64(total)*100000) / 1000
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
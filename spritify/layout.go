@@ -0,0 +1,365 @@
+package spritify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// splitSheets cuts the sorted icons into consecutive sheets of at most
+// MaxRows rows, each within MaxWidth and MaxHeight, and names them.
+func (g *Generator) splitSheets(cell image.Point) ([]*Sheet, error) {
+	rows := g.opts.MaxRows
+	if g.opts.Layout == LayoutGrid {
+		rows *= g.opts.Columns
+	}
+	if rows <= 0 || rows > len(g.icons) {
+		rows = len(g.icons)
+	}
+
+	var sheets []*Sheet
+	for start := 0; start < len(g.icons) || len(sheets) == 0; start += rows {
+		end := start + rows
+		if end > len(g.icons) {
+			end = len(g.icons)
+		}
+
+		groups, err := g.fitSheets(g.icons[start:end], cell)
+		if err != nil {
+			return nil, err
+		}
+		for _, icons := range groups {
+			sheet := &Sheet{Index: len(sheets), Icons: icons}
+			for _, icon := range sheet.Icons {
+				icon.Sheet = sheet.Index
+			}
+			sheets = append(sheets, sheet)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, sheet := range sheets {
+		filename, err := g.sheetFilename(sheet.Index, len(sheets))
+		if err != nil {
+			return nil, err
+		}
+		if seen[filename] || strings.ContainsAny(filename, `/\`) {
+			return nil, fmt.Errorf("sheet name template gives an unusable or duplicate sheet name %q", filename)
+		}
+		seen[filename] = true
+		sheet.Filename = filename
+	}
+
+	return sheets, nil
+}
+
+// fitSheets splits icons into runs that each pack within MaxWidth and
+// MaxHeight, taking as many icons as fit into every sheet.
+func (g *Generator) fitSheets(icons []*Icon, cell image.Point) ([][]*Icon, error) {
+	if g.opts.MaxWidth <= 0 && g.opts.MaxHeight <= 0 {
+		return [][]*Icon{icons}, nil
+	}
+
+	var groups [][]*Icon
+	for len(icons) > 0 {
+		// more icons hardly ever pack smaller, so search for the longest
+		// run that fits, then step back in case the packer disagrees
+		n := sort.Search(len(icons), func(n int) bool {
+			return !g.fits(icons[:n+1], cell)
+		})
+		for n > 0 && !g.fits(icons[:n], cell) {
+			n--
+		}
+		if n == 0 {
+			size := g.packedSize(icons[:1], cell)
+			return nil, fmt.Errorf("%s needs a %dx%d sheet, larger than the maximum of %s", icons[0].Name, size.X, size.Y, g.maxSheetSize())
+		}
+		groups = append(groups, icons[:n])
+		icons = icons[n:]
+	}
+	return groups, nil
+}
+
+func (g *Generator) fits(icons []*Icon, cell image.Point) bool {
+	size := g.packedSize(icons, cell)
+	return (g.opts.MaxWidth <= 0 || size.X <= g.opts.MaxWidth) &&
+		(g.opts.MaxHeight <= 0 || size.Y <= g.opts.MaxHeight)
+}
+
+func (g *Generator) maxSheetSize() string {
+	limit := func(n int) string {
+		if n <= 0 {
+			return "any"
+		}
+		return strconv.Itoa(n)
+	}
+	return limit(g.opts.MaxWidth) + "x" + limit(g.opts.MaxHeight)
+}
+
+// hashedFilename turns "sprite.png" into "sprite.<sha256-8>.png" so a
+// changed sheet gets a new url and never comes out of a stale cache.
+func hashedFilename(filename string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+func (g *Generator) sheetFilename(index int, count int) (string, error) {
+	if count == 1 {
+		return g.opts.Name + "." + g.opts.OutputFormat, nil
+	}
+
+	var buf bytes.Buffer
+	err := g.tpl.Execute(&buf, struct {
+		Name   string
+		Index  int
+		Number int
+	}{g.opts.Name, index, index + 1})
+	if err != nil {
+		return "", fmt.Errorf("sheet name template: %v", err)
+	}
+
+	return buf.String() + "." + g.opts.OutputFormat, nil
+}
+
+// cellSize returns the smallest cell of the given W:H ratio that fits every
+// icon, or the zero point when cells are disabled.
+func cellSize(icons []*Icon, ratio image.Point) image.Point {
+	if ratio == image.ZP {
+		return image.ZP
+	}
+
+	var w, h int
+	for _, icon := range icons {
+		size := icon.size()
+		if size.X > w {
+			w = size.X
+		}
+		if size.Y > h {
+			h = size.Y
+		}
+	}
+
+	if w*ratio.Y < h*ratio.X {
+		w = (h*ratio.X + ratio.Y - 1) / ratio.Y
+	} else {
+		h = (w*ratio.Y + ratio.X - 1) / ratio.X
+	}
+
+	return image.Pt(w, h)
+}
+
+// Insets are distances from the four edges of a rectangle, like a css
+// padding.
+type Insets struct {
+	Top, Right, Bottom, Left int
+}
+
+// UniformInsets returns n on every side.
+func UniformInsets(n int) Insets {
+	return Insets{n, n, n, n}
+}
+
+func (in Insets) topLeft() image.Point {
+	return image.Pt(in.Left, in.Top)
+}
+
+// layout places the icons with the configured packer, assigning Rect and
+// Cell, and returns the bounds of the sheet. Every slot is grown by the
+// gap on its right and bottom so the packer needs no notion of spacing,
+// and the packed area is moved in by the padding.
+func (g *Generator) layout(icons []*Icon, cell image.Point) image.Rectangle {
+	if g.opts.Previous != nil || g.hasFixed() {
+		return g.appendLayout(icons)
+	}
+
+	sizes := g.slotSizes(icons, cell)
+	positions, used := g.packer.Pack(sizes)
+
+	for idx, icon := range icons {
+		size := icon.size()
+		slot := sizes[idx].Sub(g.gap)
+		min := positions[idx].Add(g.padding.topLeft())
+
+		icon.Cell = image.Rectangle{Min: min, Max: min.Add(slot)}.Inset(g.imagePadding(icon))
+		pt := min.Add(slot.Sub(size).Div(2))
+		icon.Rect = image.Rectangle{Min: pt, Max: pt.Add(size)}
+	}
+
+	return g.sheetBounds(used)
+}
+
+// sheetBounds is the sheet around the area the packer used: without the
+// gap after the last slots, plus the padding, and grown to powers of two
+// with PowerOfTwo.
+func (g *Generator) sheetBounds(used image.Point) image.Rectangle {
+	size := image.Pt(
+		maxInt(used.X-g.gap.X, 0)+g.padding.Left+g.padding.Right,
+		maxInt(used.Y-g.gap.Y, 0)+g.padding.Top+g.padding.Bottom,
+	)
+	if g.opts.PowerOfTwo {
+		size = image.Pt(powerOfTwo(size.X), powerOfTwo(size.Y))
+	}
+	return image.Rectangle{Max: size}
+}
+
+func powerOfTwo(n int) int {
+	pot := 1
+	for pot < n {
+		pot *= 2
+	}
+	return pot
+}
+
+// packedSize is the size of the sheet layout would make of icons.
+func (g *Generator) packedSize(icons []*Icon, cell image.Point) image.Point {
+	_, used := g.packer.Pack(g.slotSizes(icons, cell))
+	return g.sheetBounds(used).Max
+}
+
+func (g *Generator) slotSizes(icons []*Icon, cell image.Point) []image.Point {
+	sizes := make([]image.Point, len(icons))
+
+	for idx, icon := range icons {
+		slot := icon.size()
+		if cell != image.ZP {
+			slot = cell
+		}
+		pad := g.imagePadding(icon)
+		sizes[idx] = slot.Add(image.Pt(2*pad, 2*pad)).Add(g.gap)
+	}
+	return sizes
+}
+
+// appendLayout keeps every icon of Options.Previous that still has the same
+// size where it was, puts those with an ImageOptions.Position there, and
+// packs the rest around them, like layout does with slots grown by the gap.
+func (g *Generator) appendLayout(icons []*Icon) image.Rectangle {
+	offset := g.padding.topLeft()
+	previous := make(map[string]image.Rectangle, len(g.opts.Previous))
+	for _, region := range g.opts.Previous {
+		previous[region.Name] = region.Rect
+	}
+	for name, rect := range g.fixedRegions(icons) {
+		previous[name] = rect
+	}
+
+	var fixed []image.Rectangle
+	var added []*Icon
+	var sizes []image.Point
+	for _, icon := range icons {
+		rect, ok := previous[icon.Name]
+		pad := image.Pt(g.imagePadding(icon), g.imagePadding(icon))
+		switch {
+		case ok && rect.Size() == icon.size() && rect.Min.X-pad.X >= offset.X && rect.Min.Y-pad.Y >= offset.Y:
+			icon.Rect, icon.Cell = rect, rect
+			min := rect.Min.Sub(offset).Sub(pad)
+			fixed = append(fixed, image.Rectangle{Min: min, Max: min.Add(rect.Size()).Add(pad.Mul(2)).Add(g.gap)})
+		case ok && rect.Size() == icon.size():
+			g.warn("%s would overlap the sheet padding at %v, packing it anew", icon.Name, rect.Min)
+			added = append(added, icon)
+			sizes = append(sizes, icon.size().Add(pad.Mul(2)).Add(g.gap))
+		case ok:
+			g.warn("%s changed size, packing it anew", icon.Name)
+			fallthrough
+		default:
+			added = append(added, icon)
+			sizes = append(sizes, icon.size().Add(pad.Mul(2)).Add(g.gap))
+		}
+	}
+
+	positions, used := packAround(fixed, sizes)
+	for idx, icon := range added {
+		min := positions[idx].Add(offset).Add(image.Pt(g.imagePadding(icon), g.imagePadding(icon)))
+		icon.Rect = image.Rectangle{Min: min, Max: min.Add(icon.size())}
+		icon.Cell = icon.Rect
+	}
+
+	return g.sheetBounds(used)
+}
+
+// newSheet returns an empty sheet filled with Options.Background.
+func (g *Generator) newSheet(rect image.Rectangle) *image.NRGBA {
+	nrgba := image.NewNRGBA(rect)
+	if g.opts.Background != nil {
+		draw.Draw(nrgba, rect, image.NewUniform(g.opts.Background), image.ZP, draw.Src)
+	}
+	return nrgba
+}
+
+// streamSprite draws the sheet like fillInSprite, decoding every image
+// right before drawing it and dropping it afterwards, so no more than Jobs
+// sources are held at a time.
+func (g *Generator) streamSprite(icons []*Icon, rect image.Rectangle) (*image.NRGBA, error) {
+	nrgba := g.newSheet(rect)
+	queue := make(chan *Icon)
+	errs := make(chan error, len(icons))
+	var workers sync.WaitGroup
+
+	for n := 0; n < g.opts.Jobs; n++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for icon := range queue {
+				g.opts.Decoders.acquire()
+				img, err := g.decodeFile(icon.path, false)
+				g.opts.Decoders.release()
+
+				switch {
+				case err != nil:
+					errs <- err
+				case img.Bounds().Size() != icon.SourceSize:
+					errs <- &DecodeError{icon.path, errors.New("changed size while the sprite was generated")}
+				default:
+					draw.Draw(nrgba, icon.Rect, img, img.Bounds().Min, draw.Over)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, icon := range icons {
+		select {
+		case queue <- icon:
+		case <-g.ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	workers.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	if err := g.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nrgba, nil
+}
+
+func fillInSprite(nrgba *image.NRGBA, icons []*Icon) *image.NRGBA {
+	var wg sync.WaitGroup
+
+	for _, icon := range icons {
+		wg.Add(1)
+
+		go (func(img image.Image, r image.Rectangle) {
+			defer wg.Done()
+			draw.Draw(nrgba, r, img, img.Bounds().Min, draw.Over)
+		})(icon.Source, icon.Rect)
+	}
+
+	wg.Wait()
+
+	return nrgba
+}
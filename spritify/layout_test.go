@@ -0,0 +1,80 @@
+package spritify
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFillInSpriteKeepsGIFTransparency(t *testing.T) {
+	palette := color.Palette{color.RGBA{}, color.RGBA{0xff, 0, 0, 0xff}}
+	frame := image.NewPaletted(image.Rect(0, 0, 6, 6), palette)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			frame.SetColorIndex(x, y, uint8((x+y)%2))
+		}
+	}
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "checker.gif"), buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// an opaque neighbour, so the sheet is not transparent by accident
+	var opaque bytes.Buffer
+	white := image.NewNRGBA(image.Rect(0, 0, 6, 6))
+	for i := range white.Pix {
+		white.Pix[i] = 0xff
+	}
+	if err := png.Encode(&opaque, white); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "white.png"), opaque.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.Src = src
+	opts.Extensions = []string{"gif", "png"}
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := png.Decode(bytes.NewReader(result.Sheets[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed := false
+	for _, icon := range result.Icons {
+		if icon.Name != "checker.gif" {
+			continue
+		}
+		packed = true
+		for y := 0; y < 6; y++ {
+			for x := 0; x < 6; x++ {
+				at := icon.Rect.Min.Add(image.Pt(x, y))
+				want := uint8(0)
+				if (x+y)%2 == 1 {
+					want = 0xff
+				}
+				if a := result.Sheets[0].Image.NRGBAAt(at.X, at.Y).A; a != want {
+					t.Errorf("sheet alpha at %d,%d of the gif = %d, want %d", x, y, a, want)
+				}
+				if _, _, _, a := encoded.At(at.X, at.Y).RGBA(); uint8(a>>8) != want {
+					t.Errorf("encoded alpha at %d,%d of the gif = %d, want %d", x, y, a>>8, want)
+				}
+			}
+		}
+	}
+	if !packed {
+		t.Fatal("checker.gif is not on the sheet")
+	}
+}
@@ -0,0 +1,187 @@
+package spritify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Options.ManifestFormats values.
+const (
+	ManifestJSON = "json"
+	ManifestCSV  = "csv"  // one row per icon, without frames
+	ManifestYAML = "yaml" // the JSON manifest as yaml, always with a sheets list
+)
+
+type manifestSheet struct {
+	Image  string `json:"image"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Hash   string `json:"hash"`
+}
+
+type manifestIcon struct {
+	Name   string          `json:"name"`
+	Class  string          `json:"class"`
+	Sheet  int             `json:"sheet"`
+	X      int             `json:"x"`
+	Y      int             `json:"y"`
+	Width  int             `json:"width"`
+	Height int             `json:"height"`
+	Frames []manifestFrame `json:"frames,omitempty"`
+}
+
+type manifestFrame struct {
+	X        int `json:"x"`
+	Y        int `json:"y"`
+	Width    int `json:"width"`
+	Height   int `json:"height"`
+	Duration int `json:"duration"` // milliseconds
+}
+
+type manifest struct {
+	Sheet  *manifestSheet  `json:"sheet,omitempty"`
+	Sheets []manifestSheet `json:"sheets,omitempty"`
+	Icons  []manifestIcon  `json:"icons"`
+}
+
+// Manifest renders the JSON description of the generated sheets and the
+// position of every icon on them.
+func (r *Result) Manifest() ([]byte, error) {
+	m := r.manifest()
+
+	// a single sheet keeps the original top-level "sheet" object
+	if len(m.Sheets) == 1 {
+		m.Sheet, m.Sheets = &m.Sheets[0], nil
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+func (r *Result) manifest() manifest {
+	var m manifest
+	for _, sheet := range r.Sheets {
+		sum := sha256.Sum256(sheet.Data)
+		m.Sheets = append(m.Sheets, manifestSheet{
+			Image:  sheet.Filename,
+			Width:  sheet.Image.Bounds().Dx(),
+			Height: sheet.Image.Bounds().Dy(),
+			Format: sheet.Format,
+			Hash:   "sha256:" + hex.EncodeToString(sum[:]),
+		})
+	}
+
+	m.Icons = make([]manifestIcon, 0, len(r.Icons))
+	for _, icon := range r.Icons {
+		var frames []manifestFrame
+		for _, frame := range icon.Frames {
+			rect := frame.Rect.Add(icon.Rect.Min)
+			frames = append(frames, manifestFrame{
+				X:        rect.Min.X,
+				Y:        rect.Min.Y,
+				Width:    rect.Dx(),
+				Height:   rect.Dy(),
+				Duration: int(frame.Delay / time.Millisecond),
+			})
+		}
+
+		m.Icons = append(m.Icons, manifestIcon{
+			Name:   icon.Name,
+			Class:  icon.ClassName(),
+			Sheet:  icon.Sheet,
+			X:      icon.Rect.Min.X,
+			Y:      icon.Rect.Min.Y,
+			Width:  icon.Rect.Dx(),
+			Height: icon.Rect.Dy(),
+			Frames: frames,
+		})
+	}
+	return m
+}
+
+// ManifestCSV renders the manifest as a table with a header row and a row
+// per icon, naming its sheet by file.
+func (r *Result) ManifestCSV() ([]byte, error) {
+	m := r.manifest()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"name", "class", "sheet", "x", "y", "width", "height"})
+	for _, icon := range m.Icons {
+		w.Write([]string{icon.Name, icon.Class, m.Sheets[icon.Sheet].Image,
+			strconv.Itoa(icon.X), strconv.Itoa(icon.Y), strconv.Itoa(icon.Width), strconv.Itoa(icon.Height)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ManifestYAML renders the manifest as yaml, with the same keys as the JSON
+// one. Strings are double quoted, which makes them JSON and yaml alike.
+func (r *Result) ManifestYAML() []byte {
+	m := r.manifest()
+
+	var buf bytes.Buffer
+	buf.WriteString("sheets:\n")
+	for _, sheet := range m.Sheets {
+		fmt.Fprintf(&buf, "  - image: %s\n    width: %d\n    height: %d\n    format: %s\n    hash: %s\n",
+			jsString(sheet.Image), sheet.Width, sheet.Height, jsString(sheet.Format), jsString(sheet.Hash))
+	}
+
+	if len(m.Icons) == 0 {
+		buf.WriteString("icons: []\n")
+		return buf.Bytes()
+	}
+	buf.WriteString("icons:\n")
+	for _, icon := range m.Icons {
+		fmt.Fprintf(&buf, "  - name: %s\n    class: %s\n    sheet: %d\n    x: %d\n    y: %d\n    width: %d\n    height: %d\n",
+			jsString(icon.Name), jsString(icon.Class), icon.Sheet, icon.X, icon.Y, icon.Width, icon.Height)
+		if len(icon.Frames) > 0 {
+			buf.WriteString("    frames:\n")
+			for _, frame := range icon.Frames {
+				fmt.Fprintf(&buf, "      - {x: %d, y: %d, width: %d, height: %d, duration: %d}\n", frame.X, frame.Y, frame.Width, frame.Height, frame.Duration)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// manifestFiles renders every manifest of Options.ManifestFormats.
+func (r *Result) manifestFiles() ([]File, error) {
+	formats := r.opts.ManifestFormats
+	if len(formats) == 0 {
+		formats = []string{ManifestJSON}
+	}
+
+	files := make([]File, 0, len(formats))
+	for _, format := range formats {
+		var data []byte
+		var err error
+		switch format {
+		case ManifestJSON:
+			data, err = r.Manifest()
+		case ManifestCSV:
+			data, err = r.ManifestCSV()
+		case ManifestYAML:
+			data = r.ManifestYAML()
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{r.opts.Name + "." + format, data})
+	}
+	return files, nil
+}
@@ -0,0 +1,156 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File is one rendered output, named relative to the output directory.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Files renders every output selected by the options: the sheets, the
+// stylesheet, the demo page and, when enabled, base64 sidecars, debug svgs,
+// @2x and other density sheets, the manifest and the files of every extra
+// format.
+func (r *Result) Files() ([]File, error) {
+	var files []File
+
+	for _, sheet := range r.Sheets {
+		files = append(files, File{sheet.Filename, sheet.Data})
+
+		if r.opts.Base64 {
+			files = append(files, File{sheet.Filename + ".b64", []byte(base64.StdEncoding.EncodeToString(sheet.Data))})
+		}
+
+		if r.opts.DebugSVG {
+			files = append(files, File{strings.TrimSuffix(sheet.Filename, filepath.Ext(sheet.Filename)) + ".debug.svg", r.DebugSVG(sheet)})
+		}
+	}
+
+	for _, sheet := range r.Retina {
+		files = append(files, File{sheet.Filename, sheet.Data})
+	}
+	for _, set := range r.Scaled {
+		for _, sheet := range set.Sheets {
+			files = append(files, File{sheet.Filename, sheet.Data})
+		}
+	}
+
+	if r.opts.Manifest {
+		manifests, err := r.manifestFiles()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, manifests...)
+	}
+
+	for _, format := range r.opts.Formats {
+		formatFiles, err := r.Format(format)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, formatFiles...)
+	}
+
+	css, err := r.stylesheet()
+	if err != nil {
+		return nil, err
+	}
+	page, err := r.demoPage()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, File{r.CSSFilename(), css})
+	files = append(files, File{r.opts.Name + ".html", page})
+
+	return files, nil
+}
+
+// WriteTo writes the contents of f to w.
+func (f File) WriteTo(w io.Writer) (int64, error) {
+	return bytes.NewReader(f.Data).WriteTo(w)
+}
+
+// WriteTo writes the encoded sheet to w, e.g. a pipe into another tool.
+func (s *Sheet) WriteTo(w io.Writer) (int64, error) {
+	return bytes.NewReader(s.Data).WriteTo(w)
+}
+
+// WriteFiles writes files into dir, which must already exist, each through
+// WriteFileAtomic so a reader never sees a half written output. Directories
+// in the slash separated names are created as needed.
+func WriteFiles(dir string, files []File) error {
+	for _, f := range files {
+		pathname := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			return &WriteError{f.Name, err}
+		}
+		if err := WriteFileAtomic(pathname, f.Data); err != nil {
+			return &WriteError{f.Name, err}
+		}
+	}
+	return nil
+}
+
+// WriteFileAtomic replaces pathname with data by writing a temporary file
+// next to it and renaming it over, so a crash or an interrupt leaves either
+// the old file or the new one. A replaced file keeps its permissions, a new
+// one is made readable by everyone.
+func WriteFileAtomic(pathname string, data []byte) (err error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(pathname); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(pathname), "."+filepath.Base(pathname)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), pathname)
+}
+
+// WriteFilesTo writes every file to the writer create returns for its
+// name, closing it afterwards, so the outputs can go anywhere an
+// io.Writer does. Failures are returned as a *WriteError.
+func WriteFilesTo(files []File, create func(name string) (io.WriteCloser, error)) error {
+	for _, f := range files {
+		w, err := create(f.Name)
+		if err != nil {
+			return &WriteError{f.Name, err}
+		}
+		_, err = f.WriteTo(w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return &WriteError{f.Name, err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// Packer places rectangles of the given sizes without overlap. It returns
+// the top-left corner of every rectangle, in input order, and the size of
+// the area used. Spacing is already included in the sizes.
+type Packer interface {
+	Pack(sizes []image.Point) (positions []image.Point, size image.Point)
+}
+
+const (
+	LayoutVertical   = "vertical"
+	LayoutHorizontal = "horizontal"
+	LayoutGrid       = "grid"
+	LayoutBinPack    = "binpack"
+)
+
+func packerFor(layout string, columns int) (Packer, error) {
+	switch layout {
+	case "", LayoutVertical:
+		return VerticalPacker{}, nil
+	case LayoutHorizontal:
+		return HorizontalPacker{}, nil
+	case LayoutGrid:
+		return GridPacker{Columns: columns}, nil
+	case LayoutBinPack:
+		return MaxRectsPacker{}, nil
+	}
+	return nil, fmt.Errorf("unknown layout %q", layout)
+}
+
+// VerticalPacker stacks the rectangles top to bottom, left aligned.
+type VerticalPacker struct{}
+
+func (VerticalPacker) Pack(sizes []image.Point) ([]image.Point, image.Point) {
+	positions := make([]image.Point, len(sizes))
+	var used image.Point
+
+	for idx, size := range sizes {
+		positions[idx] = image.Pt(0, used.Y)
+		used.Y += size.Y
+		if size.X > used.X {
+			used.X = size.X
+		}
+	}
+
+	return positions, used
+}
+
+// HorizontalPacker lines the rectangles up left to right, top aligned.
+type HorizontalPacker struct{}
+
+func (HorizontalPacker) Pack(sizes []image.Point) ([]image.Point, image.Point) {
+	positions := make([]image.Point, len(sizes))
+	var used image.Point
+
+	for idx, size := range sizes {
+		positions[idx] = image.Pt(used.X, 0)
+		used.X += size.X
+		if size.Y > used.Y {
+			used.Y = size.Y
+		}
+	}
+
+	return positions, used
+}
+
+// GridPacker puts the rectangles in rows of Columns equally sized cells, as
+// large as the largest rectangle. Zero Columns picks a near-square grid.
+type GridPacker struct {
+	Columns int
+}
+
+func (p GridPacker) Pack(sizes []image.Point) ([]image.Point, image.Point) {
+	positions := make([]image.Point, len(sizes))
+	if len(sizes) == 0 {
+		return positions, image.ZP
+	}
+
+	columns := p.Columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(sizes)))))
+	}
+	if columns > len(sizes) {
+		columns = len(sizes)
+	}
+
+	var cell image.Point
+	for _, size := range sizes {
+		cell.X = maxInt(cell.X, size.X)
+		cell.Y = maxInt(cell.Y, size.Y)
+	}
+
+	for idx := range sizes {
+		positions[idx] = image.Pt(idx%columns*cell.X, idx/columns*cell.Y)
+	}
+
+	rows := (len(sizes) + columns - 1) / columns
+	return positions, image.Pt(columns*cell.X, rows*cell.Y)
+}
+
+// MaxRectsPacker is a MaxRects bin packer using the bottom-left rule. It
+// tries a range of sheet widths and keeps the one covering the least area.
+type MaxRectsPacker struct{}
+
+func (p MaxRectsPacker) Pack(sizes []image.Point) ([]image.Point, image.Point) {
+	if len(sizes) == 0 {
+		return nil, image.ZP
+	}
+
+	// larger rectangles first; equal ones keep their (name) order
+	order := make([]int, len(sizes))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := sizes[order[a]], sizes[order[b]]
+		if ma, mb := maxInt(sa.X, sa.Y), maxInt(sb.X, sb.Y); ma != mb {
+			return ma > mb
+		}
+		return sa.X*sa.Y > sb.X*sb.Y
+	})
+
+	var area, maxW, sumH, sumW int
+	for _, size := range sizes {
+		area += size.X * size.Y
+		sumH += size.Y
+		sumW += size.X
+		maxW = maxInt(maxW, size.X)
+	}
+
+	var best []image.Point
+	var bestSize image.Point
+	root := math.Sqrt(float64(area))
+	for step := 0; step <= 10; step++ {
+		width := maxInt(maxW, int(math.Ceil(root*(1+float64(step)/10))))
+		if width > sumW {
+			width = sumW
+		}
+
+		positions, used := packMaxRects(sizes, order, image.Pt(width, sumH))
+		if best == nil || used.X*used.Y < bestSize.X*bestSize.Y ||
+			(used.X*used.Y == bestSize.X*bestSize.Y && used.X < bestSize.X) {
+			best, bestSize = positions, used
+		}
+	}
+
+	return best, bestSize
+}
+
+func packMaxRects(sizes []image.Point, order []int, bin image.Point) ([]image.Point, image.Point) {
+	return packFree(sizes, order, []image.Rectangle{{Max: bin}}, 0)
+}
+
+// packFree places sizes in the given order into the free rectangles with
+// the bottom-left rule. A rectangle that fits nowhere goes below bottom.
+func packFree(sizes []image.Point, order []int, free []image.Rectangle, bottom int) ([]image.Point, image.Point) {
+	positions := make([]image.Point, len(sizes))
+	used := image.Pt(0, bottom)
+
+	for _, idx := range order {
+		size := sizes[idx]
+		found := false
+		var place image.Rectangle
+
+		for _, f := range free {
+			if f.Dx() < size.X || f.Dy() < size.Y {
+				continue
+			}
+			candidate := image.Rectangle{Min: f.Min, Max: f.Min.Add(size)}
+			if !found || candidate.Max.Y < place.Max.Y ||
+				(candidate.Max.Y == place.Max.Y && candidate.Min.X < place.Min.X) {
+				place, found = candidate, true
+			}
+		}
+
+		if !found {
+			// bins are as tall as all rectangles stacked, so this only
+			// happens for a rectangle wider than the bin
+			place = image.Rectangle{Min: image.Pt(0, used.Y), Max: image.Pt(size.X, used.Y+size.Y)}
+		}
+
+		positions[idx] = place.Min
+		used.X = maxInt(used.X, place.Max.X)
+		used.Y = maxInt(used.Y, place.Max.Y)
+		free = splitFreeRects(free, place)
+	}
+
+	return positions, used
+}
+
+// packAround places sizes into the space left free by the fixed rectangles,
+// lowest first, and below them where nothing fits. It returns the positions
+// of the new rectangles and the size of the area used by all of them.
+func packAround(fixed []image.Rectangle, sizes []image.Point) ([]image.Point, image.Point) {
+	var used image.Point
+	for _, r := range fixed {
+		used.X = maxInt(used.X, r.Max.X)
+		used.Y = maxInt(used.Y, r.Max.Y)
+	}
+
+	bin := image.Pt(used.X, used.Y)
+	for _, size := range sizes {
+		bin.X = maxInt(bin.X, size.X)
+		bin.Y += size.Y
+	}
+
+	free := []image.Rectangle{{Max: bin}}
+	for _, r := range fixed {
+		free = splitFreeRects(free, r)
+	}
+
+	order := make([]int, len(sizes))
+	for idx := range order {
+		order[idx] = idx
+	}
+	positions, added := packFree(sizes, order, free, used.Y)
+	used.X = maxInt(used.X, added.X)
+	used.Y = maxInt(used.Y, added.Y)
+	return positions, used
+}
+
+// splitFreeRects carves placed out of every free rectangle it overlaps and
+// drops free rectangles contained in another one.
+func splitFreeRects(free []image.Rectangle, placed image.Rectangle) []image.Rectangle {
+	next := make([]image.Rectangle, 0, len(free)+4)
+	for _, f := range free {
+		if !f.Overlaps(placed) {
+			next = append(next, f)
+			continue
+		}
+		if placed.Min.X > f.Min.X {
+			next = append(next, image.Rect(f.Min.X, f.Min.Y, placed.Min.X, f.Max.Y))
+		}
+		if placed.Max.X < f.Max.X {
+			next = append(next, image.Rect(placed.Max.X, f.Min.Y, f.Max.X, f.Max.Y))
+		}
+		if placed.Min.Y > f.Min.Y {
+			next = append(next, image.Rect(f.Min.X, f.Min.Y, f.Max.X, placed.Min.Y))
+		}
+		if placed.Max.Y < f.Max.Y {
+			next = append(next, image.Rect(f.Min.X, placed.Max.Y, f.Max.X, f.Max.Y))
+		}
+	}
+
+	pruned := make([]image.Rectangle, 0, len(next))
+	for a, ra := range next {
+		contained := false
+		for b, rb := range next {
+			if a != b && ra.In(rb) && (ra != rb || a > b) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			pruned = append(pruned, ra)
+		}
+	}
+
+	return pruned
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"math/rand"
+	"testing"
+	"testing/fstest"
+)
+
+// shuffledFS lists every directory in a different order each time, as a
+// filesystem that does not sort would. It offers nothing but Open and
+// ReadDir, so fs.Glob has to go through the latter.
+type shuffledFS struct {
+	files fstest.MapFS
+	rnd   *rand.Rand
+}
+
+func (s shuffledFS) Open(name string) (fs.File, error) { return s.files.Open(name) }
+
+func (s shuffledFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := s.files.ReadDir(name)
+	s.rnd.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	return entries, err
+}
+
+func TestLayoutIgnoresDiscoveryOrder(t *testing.T) {
+	files := make(fstest.MapFS)
+	for idx := 0; idx < 40; idx++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		for i := 0; i < len(img.Pix); i += 4 {
+			copy(img.Pix[i:], []byte{uint8(idx * 6), uint8(255 - idx*6), 0x40, 0xff})
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		files[fmt.Sprintf("icons/icon%02d.png", idx)] = &fstest.MapFile{Data: buf.Bytes()}
+	}
+	// a few other sizes, so sorting by size or area has ties to settle
+	for idx, size := range []image.Point{{6, 14}, {14, 6}, {12, 12}} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rectangle{Max: size})); err != nil {
+			t.Fatal(err)
+		}
+		files[fmt.Sprintf("icons/odd%d.png", idx)] = &fstest.MapFile{Data: buf.Bytes()}
+	}
+
+	for _, layout := range []string{LayoutVertical, LayoutHorizontal, LayoutGrid, LayoutBinPack} {
+		for _, sortBy := range []string{SortName, SortSize, SortArea} {
+			var want map[string]image.Rectangle
+			for run := 0; run < 6; run++ {
+				opts := DefaultOptions()
+				opts.FS = shuffledFS{files, rand.New(rand.NewSource(int64(run)))}
+				opts.Src = "icons"
+				opts.Layout = layout
+				opts.Columns = 7
+				opts.Sort = sortBy
+				opts.Jobs = 1 + run%4
+				result, err := Generate(opts)
+				if err != nil {
+					t.Fatalf("%s by %s: %v", layout, sortBy, err)
+				}
+
+				got := make(map[string]image.Rectangle, len(result.Icons))
+				for _, icon := range result.Icons {
+					got[icon.Name] = icon.Rect
+				}
+				if want == nil {
+					want = got
+					continue
+				}
+				for name, rect := range want {
+					if got[name] != rect {
+						t.Errorf("%s by %s, run %d: %s at %v, want %v", layout, sortBy, run, name, got[name], rect)
+					}
+				}
+			}
+		}
+	}
+}
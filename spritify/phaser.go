@@ -0,0 +1,50 @@
+package spritify
+
+import "encoding/json"
+
+type phaserTexture struct {
+	Image  string    `json:"image"`
+	Format string    `json:"format"`
+	Size   tpSize    `json:"size"`
+	Scale  int       `json:"scale"`
+	Frames []tpFrame `json:"frames"`
+}
+
+// Phaser renders <name>.phaser.json, the multi atlas of Phaser 3 with a
+// texture per sheet. Phaser reads the frames of its first texture when the
+// file is loaded with this.load.atlas(), so a single sheet loads either
+// way; several need this.load.multiatlas().
+func (r *Result) Phaser() ([]File, error) {
+	textures := make([]phaserTexture, 0, len(r.Sheets))
+	for _, sheet := range r.Sheets {
+		b := sheet.Image.Bounds()
+		texture := phaserTexture{
+			Image:  sheet.Filename,
+			Format: "RGBA8888",
+			Size:   tpSize{b.Dx(), b.Dy()},
+			Scale:  1,
+			Frames: make([]tpFrame, 0, len(sheet.Icons)),
+		}
+		for _, icon := range sheet.Icons {
+			frame := newTPFrame(icon)
+			frame.Filename = icon.Name
+			texture.Frames = append(texture.Frames, frame)
+		}
+		textures = append(textures, texture)
+	}
+
+	doc := struct {
+		Textures []phaserTexture `json:"textures"`
+		Meta     struct {
+			App     string `json:"app"`
+			Version string `json:"version"`
+		} `json:"meta"`
+	}{Textures: textures}
+	doc.Meta.App, doc.Meta.Version = "gospritifulcss", "1.0"
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{r.opts.Name + ".phaser.json", append(data, '\n')}}, nil
+}
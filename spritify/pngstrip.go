@@ -0,0 +1,61 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngChunkType matches the type of an ancillary chunk, lower case first.
+var pngChunkType = regexp.MustCompile(`^[a-z][A-Za-z]{3}$`)
+
+// essentialChunks are the only chunks kept in the emitted sprite, besides
+// those of Options.KeepPNGChunks. tRNS is ancillary but changes how pixels
+// decode, so it stays as well.
+var essentialChunks = map[string]bool{
+	"IHDR": true,
+	"PLTE": true,
+	"tRNS": true,
+	"IDAT": true,
+	"IEND": true,
+}
+
+// stripPNG copies the png stream in data to w, dropping every chunk that is
+// neither in essentialChunks nor in keep so identical pixels always give
+// identical bytes.
+func stripPNG(w io.Writer, data []byte, keep map[string]bool) error {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return errors.New("not a png stream")
+	}
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+
+	rest := data[len(pngSignature):]
+	for len(rest) > 0 {
+		if len(rest) < 12 {
+			return errors.New("truncated png chunk")
+		}
+
+		size := int(binary.BigEndian.Uint32(rest[:4]))
+		if size < 0 || len(rest) < 12+size {
+			return errors.New("truncated png chunk")
+		}
+
+		chunk := rest[:12+size]
+		if kind := string(chunk[4:8]); essentialChunks[kind] || keep[kind] {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+
+		rest = rest[12+size:]
+	}
+
+	return nil
+}
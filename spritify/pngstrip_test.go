@@ -0,0 +1,148 @@
+package spritify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testPattern() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 12; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(20 * x), uint8(25 * y), 0x80, uint8(0xff - 10*x)})
+		}
+	}
+	return img
+}
+
+// pngChunk encodes one chunk with its length and crc.
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// withMetadata inserts tEXt and tIME chunks after the IHDR of a png.
+func withMetadata(data []byte) []byte {
+	ihdrEnd := len(pngSignature) + 12 + 13
+	var buf bytes.Buffer
+	buf.Write(data[:ihdrEnd])
+	buf.Write(pngChunk("tEXt", []byte("Software\x00an image editor")))
+	buf.Write(pngChunk("tIME", []byte{0x07, 0xea, 10, 14, 12, 30, 0}))
+	buf.Write(data[ihdrEnd:])
+	return buf.Bytes()
+}
+
+func TestStripPNGReproducible(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := encodeStrippedPNG(&first, testPattern()); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeStrippedPNG(&second, testPattern()); err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(first.Bytes()) != sha256.Sum256(second.Bytes()) {
+		t.Error("encoding the same pixels twice gave different bytes")
+	}
+
+	var stripped bytes.Buffer
+	if err := stripPNG(&stripped, withMetadata(first.Bytes()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if sha256.Sum256(stripped.Bytes()) != sha256.Sum256(first.Bytes()) {
+		t.Error("tEXt and tIME chunks survived stripPNG")
+	}
+}
+
+func TestSheetIgnoresSourceMetadata(t *testing.T) {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, testPattern()); err != nil {
+		t.Fatal(err)
+	}
+
+	var sums [][sha256.Size]byte
+	for _, data := range [][]byte{plain.Bytes(), withMetadata(plain.Bytes())} {
+		src := t.TempDir()
+		if err := os.WriteFile(filepath.Join(src, "icon.png"), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		opts := DefaultOptions()
+		opts.Src = src
+		result, err := Generate(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sheet bytes.Buffer
+		if _, err := result.Sheets[0].WriteTo(&sheet); err != nil {
+			t.Fatal(err)
+		}
+		sums = append(sums, sha256.Sum256(sheet.Bytes()))
+	}
+	if sums[0] != sums[1] {
+		t.Error("a source with tEXt and tIME chunks gave a different sheet")
+	}
+}
+
+func TestOptimizedSheetStripped(t *testing.T) {
+	src := t.TempDir()
+	writePNG(t, filepath.Join(src, "icon.png"), image.Pt(6, 6), color.Black)
+
+	var sheets [][]byte
+	for _, keep := range [][]string{nil, {"pHYs"}} {
+		opts := DefaultOptions()
+		opts.Src = src
+		opts.KeepPNGChunks = keep
+		opts.Optimize = func(data []byte) ([]byte, error) {
+			// what an optimizer adding metadata would hand back
+			data = withMetadata(data)
+			ihdrEnd := len(pngSignature) + 12 + 13
+			phys := pngChunk("pHYs", []byte{0, 0, 0x0b, 0x13, 0, 0, 0x0b, 0x13, 1})
+			return append(append(append([]byte(nil), data[:ihdrEnd]...), phys...), data[ihdrEnd:]...), nil
+		}
+		result, err := Generate(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheets = append(sheets, result.Sheets[0].Data)
+	}
+
+	for idx, sheet := range sheets {
+		for _, kind := range []string{"tEXt", "tIME"} {
+			if bytes.Contains(sheet, []byte(kind)) {
+				t.Errorf("sheet %d keeps the %s chunk of the optimizer", idx, kind)
+			}
+		}
+	}
+	if bytes.Contains(sheets[0], []byte("pHYs")) {
+		t.Error("pHYs kept without KeepPNGChunks")
+	}
+	if !bytes.Contains(sheets[1], []byte("pHYs")) {
+		t.Error("pHYs stripped although KeepPNGChunks lists it")
+	}
+}
+
+func TestKeepPNGChunksValidated(t *testing.T) {
+	for _, keep := range []string{"IDAT", "phy", "pHYs!"} {
+		opts := DefaultOptions()
+		opts.KeepPNGChunks = []string{keep}
+		if _, err := NewGenerator(opts); err == nil {
+			t.Errorf("KeepPNGChunks %q accepted", keep)
+		}
+	}
+	opts := DefaultOptions()
+	opts.OutputFormat = "jpeg"
+	opts.KeepPNGChunks = []string{"pHYs"}
+	if _, err := NewGenerator(opts); err == nil {
+		t.Error("KeepPNGChunks accepted with jpeg output")
+	}
+}
@@ -0,0 +1,65 @@
+package spritify
+
+// Stages of a run, as reported in Progress.Stage.
+const (
+	StageDecode = "decode" // Done of Total source files read
+	StagePack   = "pack"   // Done of Total sheets laid out and drawn
+	StageEncode = "encode" // Done of Total sheets encoded, @2x and density copies included
+)
+
+// Progress is one step of a run, see Options.Progress.
+type Progress struct {
+	Stage string
+	Done  int
+	Total int
+}
+
+// progress reports done of total for stage to Options.Progress. Decoding
+// reports from several workers, so calls are serialized here and the
+// callback needs no locking of its own.
+func (g *Generator) progress(stage string, done, total int) {
+	if g.opts.Progress == nil {
+		return
+	}
+	g.progressMu.Lock()
+	defer g.progressMu.Unlock()
+	g.opts.Progress(Progress{stage, done, total})
+}
+
+// decoded counts one more source file read and reports it, keeping Done
+// increasing whichever worker gets there first.
+func (g *Generator) decoded(total int) {
+	if g.opts.Progress == nil {
+		return
+	}
+	g.progressMu.Lock()
+	defer g.progressMu.Unlock()
+	g.decodedN++
+	g.opts.Progress(Progress{StageDecode, g.decodedN, total})
+}
+
+// encoded counts one more sheet encoded and reports it.
+func (g *Generator) encoded(total int) {
+	if g.opts.Progress == nil {
+		return
+	}
+	g.progressMu.Lock()
+	defer g.progressMu.Unlock()
+	g.encodedN++
+	g.opts.Progress(Progress{StageEncode, g.encodedN, total})
+}
+
+// encodeTotal is the number of sheets a run of sheets encodes, with their
+// @2x and density copies.
+func (g *Generator) encodeTotal(sheets int) int {
+	copies := 1
+	if g.opts.Retina {
+		copies++
+	}
+	for _, d := range g.opts.Densities {
+		if d != 1 {
+			copies++
+		}
+	}
+	return sheets * copies
+}
@@ -0,0 +1,208 @@
+package spritify
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+const (
+	DitherNone           = "none"
+	DitherFloydSteinberg = "floyd-steinberg"
+)
+
+// colorBox is a set of distinct colors for median cut, with how often each
+// occurs.
+type colorBox struct {
+	colors []color.NRGBA
+	counts []int
+}
+
+// quantize reduces img to a palette of at most n colors. Sheets with no more
+// distinct colors than that are converted exactly; others get a median cut
+// palette, optionally with Floyd-Steinberg dithering. Fully transparent
+// pixels keep a palette entry of their own.
+func quantize(img *image.NRGBA, n int, dither string) *image.Paletted {
+	hist := make(map[color.NRGBA]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			hist[opaqueKey(img.NRGBAAt(x, y))]++
+		}
+	}
+
+	box := colorBox{}
+	transparent := false
+	for c, count := range hist {
+		if c.A == 0 {
+			transparent = true
+			continue
+		}
+		box.colors = append(box.colors, c)
+		box.counts = append(box.counts, count)
+	}
+	box.sort(func(c color.NRGBA) uint64 {
+		return packNRGBA(c)
+	})
+
+	var palette color.Palette
+	if transparent {
+		palette = append(palette, color.NRGBA{})
+		n--
+	}
+
+	exact := len(box.colors) <= n
+	if exact {
+		for _, c := range box.colors {
+			palette = append(palette, c)
+		}
+	} else {
+		for _, part := range medianCut(box, n) {
+			palette = append(palette, part.average())
+		}
+	}
+
+	paletted := image.NewPaletted(b, palette)
+	if !exact && dither == DitherFloydSteinberg {
+		draw.FloydSteinberg.Draw(paletted, b, img, b.Min)
+		return paletted
+	}
+
+	index := make(map[color.NRGBA]uint8, len(hist))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := opaqueKey(img.NRGBAAt(x, y))
+			idx, ok := index[c]
+			if !ok {
+				idx = uint8(palette.Index(c))
+				index[c] = idx
+			}
+			paletted.SetColorIndex(x, y, idx)
+		}
+	}
+	return paletted
+}
+
+// opaqueKey folds every fully transparent pixel into one color.
+func opaqueKey(c color.NRGBA) color.NRGBA {
+	if c.A == 0 {
+		return color.NRGBA{}
+	}
+	return c
+}
+
+// medianCut splits box until there are n boxes, always cutting the one with
+// the widest channel range at its population median.
+func medianCut(box colorBox, n int) []colorBox {
+	boxes := []colorBox{box}
+	for len(boxes) < n {
+		widest, channel, span := -1, 0, 0
+		for idx, b := range boxes {
+			if len(b.colors) < 2 {
+				continue
+			}
+			if ch, s := b.widestChannel(); s > span {
+				widest, channel, span = idx, ch, s
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		low, high := boxes[widest].split(channel)
+		boxes[widest] = low
+		boxes = append(boxes, high)
+	}
+	return boxes
+}
+
+func channel(c color.NRGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	}
+	return c.A
+}
+
+func (b colorBox) widestChannel() (int, int) {
+	best, span := 0, -1
+	for ch := 0; ch < 4; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range b.colors {
+			v := channel(c, ch)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if int(hi)-int(lo) > span {
+			best, span = ch, int(hi)-int(lo)
+		}
+	}
+	return best, span
+}
+
+// split sorts the box along ch and cuts it where half of its pixels are on
+// either side, keeping at least one color in each half.
+func (b colorBox) split(ch int) (colorBox, colorBox) {
+	b.sort(func(c color.NRGBA) uint64 {
+		return uint64(channel(c, ch))<<32 | packNRGBA(c)
+	})
+
+	total := 0
+	for _, count := range b.counts {
+		total += count
+	}
+	cut, seen := 1, b.counts[0]
+	for cut < len(b.colors)-1 && 2*seen < total {
+		seen += b.counts[cut]
+		cut++
+	}
+
+	return colorBox{b.colors[:cut], b.counts[:cut]}, colorBox{b.colors[cut:], b.counts[cut:]}
+}
+
+func packNRGBA(c color.NRGBA) uint64 {
+	return uint64(c.R)<<24 | uint64(c.G)<<16 | uint64(c.B)<<8 | uint64(c.A)
+}
+
+// sort orders the colors, and their counts with them, by a key that is
+// unique per color so the palette never depends on map order.
+func (b colorBox) sort(key func(color.NRGBA) uint64) {
+	order := make([]int, len(b.colors))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return key(b.colors[order[i]]) < key(b.colors[order[j]])
+	})
+
+	colors := make([]color.NRGBA, len(order))
+	counts := make([]int, len(order))
+	for idx, from := range order {
+		colors[idx], counts[idx] = b.colors[from], b.counts[from]
+	}
+	copy(b.colors, colors)
+	copy(b.counts, counts)
+}
+
+// average is the population weighted mean color of the box.
+func (b colorBox) average() color.NRGBA {
+	var r, g, bl, a, total int
+	for idx, c := range b.colors {
+		count := b.counts[idx]
+		r += int(c.R) * count
+		g += int(c.G) * count
+		bl += int(c.B) * count
+		a += int(c.A) * count
+		total += count
+	}
+	return color.NRGBA{uint8(r / total), uint8(g / total), uint8(bl / total), uint8(a / total)}
+}
@@ -0,0 +1,52 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// React renders Icon.tsx, a component showing one icon of the sprite by
+// its typed name prop as a span of the icon's size with the sheet as its
+// background. The placements are part of the file, so it needs nothing but
+// the sheets, and any other span props and style are passed through.
+func (r *Result) React() File {
+	names := r.moduleNames()
+
+	var buf bytes.Buffer
+	buf.WriteString("import type { HTMLAttributes } from \"react\";\n\n")
+	fmt.Fprintf(&buf, "const sheets = [%s];\n\n", strings.Join(r.sheetURLs(), ", "))
+	buf.WriteString("// x, y, width, height and index into sheets\n")
+	buf.WriteString("const icons = {\n")
+	for idx, icon := range r.Icons {
+		fmt.Fprintf(&buf, "  %s: [%d, %d, %d, %d, %d],\n", jsString(names[idx]), icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy(), icon.Sheet)
+	}
+	buf.WriteString("} as const;\n\n")
+
+	buf.WriteString(`export type IconName = keyof typeof icons;
+
+export interface IconProps extends HTMLAttributes<HTMLSpanElement> {
+  name: IconName;
+}
+
+export function Icon({ name, style, ...props }: IconProps) {
+  const [x, y, width, height, sheet] = icons[name];
+  return (
+    <span
+      {...props}
+      style={{
+        display: "inline-block",
+        width,
+        height,
+        background: ` + "`url(\"${sheets[sheet]}\") no-repeat ${-x}px ${-y}px`" + `,
+        ...style,
+      }}
+    />
+  );
+}
+
+export default Icon;
+`)
+
+	return File{"Icon.tsx", buf.Bytes()}
+}
@@ -0,0 +1,150 @@
+package spritify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFetchTimeout = 30 * time.Second
+	defaultFetchRetries = 2
+
+	// maxFetchSize is the largest body a url may answer with.
+	maxFetchSize = 64 << 20
+)
+
+// remoteSource is one of Options.URLs once fetched.
+type remoteSource struct {
+	name string // last element of the url path, the icon name
+	data []byte
+}
+
+// urlName is the icon name of an Options.URLs entry, "" when it is not an
+// http or https url of a file.
+func urlName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// fetchURLs downloads Options.URLs, Jobs at a time, and returns paths
+// without those that could not be fetched. They are reported like files
+// that could not be read.
+func (g *Generator) fetchURLs(paths []string) []string {
+	g.fetched = make(map[string]remoteSource, len(g.opts.URLs))
+	if len(g.opts.URLs) == 0 {
+		return paths
+	}
+
+	queue := make(chan string)
+	var workers sync.WaitGroup
+	for n := 0; n < g.opts.Jobs; n++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for rawURL := range queue {
+				data, err := g.fetch(rawURL)
+				if err != nil {
+					g.fail(&DecodeError{rawURL, err})
+					continue
+				}
+				g.mu.Lock()
+				g.fetched[rawURL] = remoteSource{urlName(rawURL), data}
+				g.mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, rawURL := range g.opts.URLs {
+		select {
+		case queue <- rawURL:
+		case <-g.ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	workers.Wait()
+
+	remote := make(map[string]bool, len(g.opts.URLs))
+	for _, rawURL := range g.opts.URLs {
+		remote[rawURL] = true
+	}
+	fetched := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if _, ok := g.fetched[p]; ok || !remote[p] {
+			fetched = append(fetched, p)
+		}
+	}
+	return fetched
+}
+
+// fetch gets rawURL, trying again after a network error, a timeout or a
+// server error, but not after a status the client has to fix.
+func (g *Generator) fetch(rawURL string) ([]byte, error) {
+	retries := g.opts.FetchRetries
+	if retries == 0 {
+		retries = defaultFetchRetries
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var data []byte
+		var retry bool
+		if data, retry, err = g.fetchOnce(rawURL); err == nil {
+			return data, nil
+		}
+		if !retry || attempt >= retries {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt+1) * 500 * time.Millisecond):
+		case <-g.ctx.Done():
+			return nil, g.ctx.Err()
+		}
+	}
+}
+
+func (g *Generator) fetchOnce(rawURL string) (data []byte, retry bool, err error) {
+	timeout := g.opts.FetchTimeout
+	if timeout == 0 {
+		timeout = defaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(g.ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, g.ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("GET: %s", resp.Status)
+	}
+	if data, err = io.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1)); err != nil {
+		return nil, g.ctx.Err() == nil, err
+	}
+	if len(data) > maxFetchSize {
+		return nil, false, fmt.Errorf("GET: body larger than %d MiB", maxFetchSize>>20)
+	}
+	return data, false, nil
+}
@@ -0,0 +1,28 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// LayoutReport renders one line per image sorted by name so layout changes
+// show up as readable diffs in review.
+func (r *Result) LayoutReport() []byte {
+	var buf bytes.Buffer
+	for _, sheet := range r.Sheets {
+		b := sheet.Image.Bounds()
+		fmt.Fprintf(&buf, "sheet %s %dx%d images %d\n", sheet.Filename, b.Dx(), b.Dy(), len(sheet.Icons))
+	}
+	sorted := make([]*Icon, len(r.Icons))
+	copy(sorted, r.Icons)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Name < sorted[b].Name
+	})
+
+	for _, icon := range sorted {
+		fmt.Fprintf(&buf, "%s sheet=%d x=%d y=%d w=%d h=%d\n", icon.Name, icon.Sheet, icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy())
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,225 @@
+package spritify
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Options.ResizeMode values, how a source is brought to Options.Resize.
+const (
+	ResizeFit  = "fit"  // scale to fit inside, keeping the aspect ratio
+	ResizeFill = "fill" // scale to cover and crop the overflow at the center
+	ResizePad  = "pad"  // scale to fit and center on a transparent canvas
+)
+
+// Options.ResizeFilter values.
+const (
+	FilterNearest    = "nearest"
+	FilterBilinear   = "bilinear"
+	FilterCatmullRom = "catmull-rom"
+	FilterLanczos    = "lanczos"
+)
+
+// resampleFilter is a separable reconstruction kernel, non-zero within
+// support of the sample.
+type resampleFilter struct {
+	support float64
+	kernel  func(x float64) float64
+}
+
+var resampleFilters = map[string]resampleFilter{
+	FilterBilinear: {1, func(x float64) float64 {
+		return 1 - math.Abs(x)
+	}},
+	FilterCatmullRom: {2, func(x float64) float64 {
+		x = math.Abs(x)
+		if x < 1 {
+			return (3*x-5)*x*x/2 + 1
+		}
+		return ((5-x)*x-8)*x/2 + 2
+	}},
+	FilterLanczos: {3, func(x float64) float64 {
+		if x == 0 {
+			return 1
+		}
+		px := math.Pi * x
+		return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+	}},
+}
+
+// resizeIcons brings the source and the retina variant of every icon to the
+// configured size, or twice of it. With Options.Densities the size is in 1x
+// pixels and the sources are brought to the largest density.
+func (g *Generator) resizeIcons() {
+	box := g.opts.Resize.Mul(g.maxDensity())
+	for _, icon := range g.icons {
+		if icon.Frames != nil {
+			icon.Source, icon.Frames = g.resizeStrip(icon.Source, icon.Frames)
+		} else {
+			icon.Source = g.resize(icon.Source, box)
+		}
+		icon.SourceSize = icon.Source.Bounds().Size()
+
+		if icon.Retina != nil {
+			icon.Retina = g.resize(icon.Retina, g.opts.Resize.Mul(2))
+		}
+	}
+}
+
+// resize scales img to box following Options.ResizeMode.
+func (g *Generator) resize(img image.Image, box image.Point) *image.NRGBA {
+	b := img.Bounds()
+	sx := float64(box.X) / float64(b.Dx())
+	sy := float64(box.Y) / float64(b.Dy())
+
+	switch g.opts.ResizeMode {
+	case ResizeFill:
+		scale := math.Max(sx, sy)
+		scaled := g.resample(img, scaledSize(b.Size(), scale))
+		crop := image.Rectangle{Max: box}.Add(scaled.Bounds().Size().Sub(box).Div(2))
+		out := image.NewNRGBA(image.Rectangle{Max: box})
+		draw.Draw(out, out.Bounds(), scaled, crop.Min, draw.Src)
+		return out
+	case ResizePad:
+		scaled := g.resample(img, scaledSize(b.Size(), math.Min(sx, sy)))
+		out := image.NewNRGBA(image.Rectangle{Max: box})
+		offset := box.Sub(scaled.Bounds().Size()).Div(2)
+		draw.Draw(out, scaled.Bounds().Add(offset), scaled, image.ZP, draw.Src)
+		return out
+	default:
+		return g.resample(img, scaledSize(b.Size(), math.Min(sx, sy)))
+	}
+}
+
+// resizeStrip resizes every frame of a gif strip on its own, so the frames
+// stay evenly spaced.
+func (g *Generator) resizeStrip(strip image.Image, frames []Frame) (*image.NRGBA, []Frame) {
+	var out *image.NRGBA
+	resized := make([]Frame, len(frames))
+	min := strip.Bounds().Min
+
+	for idx, frame := range frames {
+		sub := image.NewNRGBA(image.Rectangle{Max: frame.Rect.Size()})
+		draw.Draw(sub, sub.Bounds(), strip, frame.Rect.Min.Add(min), draw.Src)
+		scaled := g.resize(sub, g.opts.Resize)
+
+		size := scaled.Bounds().Size()
+		if out == nil {
+			out = image.NewNRGBA(image.Rect(0, 0, size.X*len(frames), size.Y))
+		}
+		rect := image.Rect(idx*size.X, 0, (idx+1)*size.X, size.Y)
+		draw.Draw(out, rect, scaled, image.ZP, draw.Src)
+		resized[idx] = Frame{Rect: rect, Delay: frame.Delay}
+	}
+	return out, resized
+}
+
+func scaledSize(size image.Point, scale float64) image.Point {
+	return image.Pt(
+		maxInt(1, int(math.Round(float64(size.X)*scale))),
+		maxInt(1, int(math.Round(float64(size.Y)*scale))),
+	)
+}
+
+// resample scales img to size with Options.ResizeFilter, in premultiplied
+// alpha so transparent pixels do not bleed their color into the edges.
+func (g *Generator) resample(img image.Image, size image.Point) *image.NRGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	out := image.NewNRGBA(image.Rectangle{Max: size})
+	sw, sh := b.Dx(), b.Dy()
+
+	if g.opts.ResizeFilter == FilterNearest {
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				out.Set(x, y, src.At((2*x+1)*sw/(2*size.X), (2*y+1)*sh/(2*size.Y)))
+			}
+		}
+		return out
+	}
+
+	f := resampleFilters[g.opts.ResizeFilter]
+
+	// horizontal pass into a float buffer of size.X by sh
+	tmp := make([]float64, 4*size.X*sh)
+	for x := 0; x < size.X; x++ {
+		taps, weights := filterTaps(x, sw, size.X, f)
+		for y := 0; y < sh; y++ {
+			var px [4]float64
+			for t, sx := range taps {
+				i := src.PixOffset(sx, y)
+				for c := 0; c < 4; c++ {
+					px[c] += weights[t] * float64(src.Pix[i+c])
+				}
+			}
+			copy(tmp[4*(y*size.X+x):], px[:])
+		}
+	}
+
+	// vertical pass into out, undoing the premultiplication
+	for y := 0; y < size.Y; y++ {
+		taps, weights := filterTaps(y, sh, size.Y, f)
+		for x := 0; x < size.X; x++ {
+			var px [4]float64
+			for t, sy := range taps {
+				i := 4 * (sy*size.X + x)
+				for c := 0; c < 4; c++ {
+					px[c] += weights[t] * tmp[i+c]
+				}
+			}
+
+			a := clamp255(px[3])
+			i := out.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				out.Pix[i+c] = uint8(clamp255(px[c] * 255 / float64(a)))
+			}
+			out.Pix[i+3] = uint8(a)
+		}
+	}
+	return out
+}
+
+// filterTaps lists the source samples contributing to destination sample
+// dst of n, out of srcN, with normalized weights. Downscaling widens the
+// kernel by the scale factor so every source sample is accounted for.
+func filterTaps(dst, srcN, n int, f resampleFilter) ([]int, []float64) {
+	ratio := float64(srcN) / float64(n)
+	scale := math.Max(ratio, 1)
+	center := (float64(dst)+0.5)*ratio - 0.5
+	radius := f.support * scale
+
+	var taps []int
+	var weights []float64
+	var sum float64
+	for i := int(math.Ceil(center - radius)); i <= int(math.Floor(center+radius)); i++ {
+		w := f.kernel((float64(i) - center) / scale)
+		if w == 0 {
+			continue
+		}
+		taps = append(taps, minInt(maxInt(i, 0), srcN-1))
+		weights = append(weights, w)
+		sum += w
+	}
+	if sum == 0 {
+		return []int{minInt(maxInt(int(math.Round(center)), 0), srcN-1)}, []float64{1}
+	}
+	for idx := range weights {
+		weights[idx] /= sum
+	}
+	return taps, weights
+}
+
+func clamp255(v float64) int {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return int(v + 0.5)
+}
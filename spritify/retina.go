@@ -0,0 +1,163 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"path/filepath"
+	"strings"
+)
+
+const retinaSuffix = "@2x"
+
+func iconKey(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// pairRetina moves every "<name>@2x.<ext>" icon onto the Retina field of
+// the matching "<name>.<ext>" icon and drops it from the packing list. An
+// @2x file that is not exactly twice the size of its 1x image would be
+// cropped or leave gaps on the retina sheet, so it is left out with a
+// warning and the 1x image is upscaled instead.
+func (g *Generator) pairRetina() {
+	base := make(map[string]*Icon)
+	for _, icon := range g.icons {
+		if !strings.HasSuffix(iconKey(icon.Name), retinaSuffix) {
+			base[iconKey(icon.Name)] = icon
+		}
+	}
+
+	mismatched := make(map[*Icon]bool)
+	icons := g.icons[:0]
+	for _, icon := range g.icons {
+		key := iconKey(icon.Name)
+		if !strings.HasSuffix(key, retinaSuffix) {
+			icons = append(icons, icon)
+			continue
+		}
+
+		target, ok := base[strings.TrimSuffix(key, retinaSuffix)]
+		switch {
+		case !ok:
+			g.warn("%s: no 1x image to pair with, skipping", icon.Name)
+		case icon.SourceSize != target.SourceSize.Mul(2):
+			g.warn("%s: %dx%d is not twice the %dx%d of %s, upscaling %s for the retina sheet instead",
+				icon.Name, icon.SourceSize.X, icon.SourceSize.Y, target.SourceSize.X, target.SourceSize.Y, target.Name, target.Name)
+			mismatched[target] = true
+		default:
+			target.Retina = icon.Source
+		}
+	}
+	g.icons = icons
+
+	for _, icon := range g.icons {
+		if icon.Retina == nil && !mismatched[icon] {
+			g.warn("%s: no %s variant, upscaling it for the retina sheet", icon.Name, retinaSuffix)
+		}
+	}
+}
+
+// trimRetina crops the retina variant to twice the area kept by trimming.
+func trimRetina(icon *Icon) {
+	size := icon.Source.Bounds().Size()
+	sub, ok := icon.Retina.(subImager)
+	if !ok || size == icon.SourceSize {
+		return
+	}
+
+	min := icon.Retina.Bounds().Min
+	crop := image.Rectangle{Min: icon.TrimOffset.Mul(2), Max: icon.TrimOffset.Add(size).Mul(2)}
+	icon.Retina = sub.SubImage(crop.Add(min))
+}
+
+// retinaSheet renders the double resolution copy of sheet, with every icon
+// at twice its 1x position so background-size maps one onto the other.
+func (g *Generator) retinaSheet(sheet *Sheet) (*Sheet, error) {
+	return g.scaledSheet(sheet, 2, func(icon *Icon) image.Image {
+		if icon.Retina == nil {
+			return scale2x(icon.Source)
+		}
+		return icon.Retina
+	})
+}
+
+// scaledSheet renders a copy of sheet at scale times its resolution, named
+// with an @<scale>x suffix, drawing every icon from source at scale times
+// its 1x rectangle.
+func (g *Generator) scaledSheet(sheet *Sheet, scale int, source func(icon *Icon) image.Image) (*Sheet, error) {
+	nrgba := g.newSheet(image.Rectangle{Max: sheet.Image.Bounds().Max.Mul(scale)})
+
+	for _, icon := range sheet.Icons {
+		src := source(icon)
+		dst := image.Rectangle{Min: icon.Rect.Min.Mul(scale), Max: icon.Rect.Max.Mul(scale)}
+		draw.Draw(nrgba, dst, src, src.Bounds().Min, draw.Over)
+	}
+	extrudeScaled(nrgba, sheet.Icons, g.opts.Extrude, scale)
+
+	encoded, err := g.encodeSheet(nrgba)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(sheet.Filename)
+	return &Sheet{
+		Index:    sheet.Index,
+		Filename: fmt.Sprintf("%s@%dx%s", strings.TrimSuffix(sheet.Filename, ext), scale, ext),
+		Image:    nrgba,
+		Format:   sheet.Format,
+		Data:     encoded,
+		Icons:    sheet.Icons,
+	}, nil
+}
+
+// extrudeScaled extrudes the icons of a sheet at scale times the 1x
+// resolution, at scale times their rectangles and the width.
+func extrudeScaled(nrgba *image.NRGBA, icons []*Icon, n int, scale int) {
+	if n == 0 {
+		return
+	}
+
+	scaled := make([]*Icon, len(icons))
+	for idx, icon := range icons {
+		scaled[idx] = &Icon{Rect: image.Rectangle{Min: icon.Rect.Min.Mul(scale), Max: icon.Rect.Max.Mul(scale)}}
+	}
+	extrude(nrgba, scaled, scale*n)
+}
+
+// scale2x doubles img with nearest neighbour sampling.
+func scale2x(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 2*b.Dx(), 2*b.Dy()))
+
+	for y := 0; y < 2*b.Dy(); y++ {
+		for x := 0; x < 2*b.Dx(); x++ {
+			nrgba.Set(x, y, img.At(b.Min.X+x/2, b.Min.Y+y/2))
+		}
+	}
+
+	return nrgba
+}
+
+// retinaCSS points high density screens at the @2x sheets, scaled back down
+// to the 1x sheet size so every background-position keeps working.
+func (r *Result) retinaCSS() string {
+	return r.densityCSS(2, r.Retina)
+}
+
+// densityCSS points screens of at least density at scaled, the copies of
+// Sheets at that density.
+func (r *Result) densityCSS(density int, scaled []*Sheet) string {
+	rules := make([]string, 0, len(r.Sheets))
+
+	if len(scaled) == 1 {
+		size := r.Sheets[0].Image.Bounds().Size()
+		rules = append(rules, fmt.Sprintf(`.icon { background-image: url("%s"); background-size: %dpx %dpx;}`, r.sheetURL(scaled[0]), size.X, size.Y))
+	} else {
+		for idx, sheet := range r.Sheets {
+			size := sheet.Image.Bounds().Size()
+			rules = append(rules, fmt.Sprintf(`%s { background-image: url("%s"); background-size: %dpx %dpx;}`, r.sheetSelectors(sheet), r.sheetURL(scaled[idx]), size.X, size.Y))
+		}
+	}
+
+	return fmt.Sprintf("@media (-webkit-min-device-pixel-ratio: %d), (min-resolution: %ddpi) {\n", density, 96*density) + strings.Join(rules, "\n") + "\n}"
+}
@@ -0,0 +1,66 @@
+package spritify
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePNG(t *testing.T, pathname string, size image.Point, c color.Color) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rectangle{Max: size})
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.ZP, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pathname, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetinaSizeMismatch(t *testing.T) {
+	red, blue := color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0, 0, 0xff, 0xff}
+	src := t.TempDir()
+	writePNG(t, filepath.Join(src, "good.png"), image.Pt(8, 8), red)
+	writePNG(t, filepath.Join(src, "good@2x.png"), image.Pt(16, 16), blue)
+	writePNG(t, filepath.Join(src, "odd.png"), image.Pt(8, 8), red)
+	writePNG(t, filepath.Join(src, "odd@2x.png"), image.Pt(20, 14), blue)
+
+	opts := DefaultOptions()
+	opts.Src = src
+	opts.Retina = true
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "odd@2x.png") {
+		t.Errorf("warnings %q, want one about odd@2x.png", result.Warnings)
+	}
+
+	retina := result.Retina[0].Image
+	for _, icon := range result.Icons {
+		// the paired @2x is drawn as it is, the mismatched one is replaced
+		// by the upscaled 1x image
+		want := blue
+		if icon.Name == "odd.png" {
+			if icon.Retina != nil {
+				t.Error("odd.png was paired with an @2x of the wrong size")
+			}
+			want = red
+		}
+		rect := image.Rectangle{Min: icon.Rect.Min.Mul(2), Max: icon.Rect.Max.Mul(2)}
+		for _, at := range []image.Point{rect.Min, rect.Max.Sub(image.Pt(1, 1))} {
+			if got := retina.NRGBAAt(at.X, at.Y); got != want {
+				t.Errorf("%s: retina pixel at %v is %v, want %v", icon.Name, at, got, want)
+			}
+		}
+	}
+}
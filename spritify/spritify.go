@@ -0,0 +1,1023 @@
+// Package spritify packs a directory of images into css sprite sheets and
+// renders the stylesheets, demo page and metadata that go with them.
+//
+// The gospritifulcss command is a thin wrapper around Generate; other Go
+// programs can call it directly and write the Result wherever they like.
+package spritify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	AnchorTopLeft     = "top-left"
+	AnchorBottomRight = "bottom-right"
+)
+
+const (
+	SortName = "name" // by file name
+	SortSize = "size" // tallest first, then widest
+	SortArea = "area" // largest area first
+)
+
+// sortIcons orders icons for packing. They arrive sorted by name, which the
+// stable sort keeps as the tie-breaker.
+func sortIcons(icons []*Icon, order string) {
+	var less func(a, b image.Point) bool
+	switch order {
+	case SortSize:
+		less = func(a, b image.Point) bool {
+			if a.Y != b.Y {
+				return a.Y > b.Y
+			}
+			return a.X > b.X
+		}
+	case SortArea:
+		less = func(a, b image.Point) bool {
+			return a.X*a.Y > b.X*b.Y
+		}
+	default:
+		return
+	}
+
+	sort.SliceStable(icons, func(a, b int) bool {
+		return less(icons[a].size(), icons[b].size())
+	})
+}
+
+// Options controls discovery, layout and the set of rendered outputs.
+type Options struct {
+	Src        string   // directory holding the source images
+	Extensions []string // accepted file extensions, e.g. png, jpg
+	Exclude    []string // filepath.Match patterns for file names to skip, e.g. *-old*
+	Recursive  bool     // also read the subdirectories of Src, except hidden and excluded ones
+	Name       string   // base name of the outputs, without extension
+	MaxImages  int      // refuse to run when more files match, 0 means no limit
+	AllowEmpty bool     // build an empty sprite rather than fail with ErrNoImages
+
+	// FS, when set, is read instead of the OS filesystem, e.g. an embed.FS;
+	// Src is then a slash separated directory within it.
+	FS fs.FS
+
+	// URLs are http or https image sources packed next to those under Src,
+	// named by the last element of their path. They are fetched Jobs at a
+	// time, every attempt limited to FetchTimeout (0 for 30s) and retried
+	// FetchRetries times (0 for 2, negative for never) after a network or
+	// server error.
+	URLs         []string
+	FetchTimeout time.Duration
+	FetchRetries int
+
+	Layout            string      // LayoutVertical, LayoutHorizontal, LayoutGrid or LayoutBinPack, ignored when Packer is set
+	Columns           int         // cells per row for LayoutGrid, 0 picks a near-square grid
+	Packer            Packer      // custom placement, overrides Layout
+	Margin            int         // gap between images and around the sheet, see Gap and Padding
+	Extrude           int         // repeat the edge pixels of every image this many times into the gap
+	CellAspect        image.Point // W:H of a fixed cell reserved per image, zero to disable
+	Resize            image.Point // scale every source to this size before packing, zero keeps the sizes
+	ResizeMode        string      // ResizeFit, ResizeFill or ResizePad, defaults to ResizeFit
+	ResizeFilter      string      // FilterNearest, FilterBilinear, FilterCatmullRom or FilterLanczos, defaults to FilterCatmullRom
+	MaxRows           int         // start a new sheet after this many rows, 0 means one sheet
+	MaxWidth          int         // start a new sheet rather than grow one wider, 0 means no limit
+	MaxHeight         int         // start a new sheet rather than grow one taller, 0 means no limit
+	PowerOfTwo        bool        // round sheet dimensions up to powers of two, e.g. for GPU textures
+	Background        color.Color // fill of every sheet before the images are drawn, nil for transparent or white with jpeg
+	SheetNameTemplate string      // text/template over .Name, .Index and .Number (Index+1) for sheet names when there are several
+	OutputFormat      string      // sheet encoding and extension, "png", "jpeg", "jpg" or one added with RegisterEncoder
+	Quality           int         // jpeg quality from 1 to 100, 0 for the default of 90
+	Quantize          int         // reduce png sheets to a palette of this many colors (2-256), 0 keeps full color
+	Dither            string      // DitherFloydSteinberg or DitherNone, when Quantize has to drop colors
+	Hash              bool        // insert the first 8 hex digits of the png's sha256 into sheet names
+
+	// Compression is the zlib level of png sheets: png.DefaultCompression,
+	// BestSpeed, BestCompression or NoCompression.
+	Compression png.CompressionLevel
+
+	// Optimize, when set, rewrites every encoded sheet before it is hashed
+	// or written, e.g. with an external png optimizer. Its png output is
+	// stripped again, keeping only the essential chunks and KeepPNGChunks.
+	Optimize func(data []byte) ([]byte, error)
+
+	// KeepPNGChunks are ancillary chunk types, e.g. pHYs or iCCP, that the
+	// stripping of png sheets keeps. The encoder writes none of them, so
+	// they only survive from what Optimize adds.
+	KeepPNGChunks []string
+
+	// ExtDecoders decode files by extension, e.g. "svg", for this run only.
+	// They take precedence over RegisterDecoder, so two Generators can
+	// rasterize svg sources at different scales.
+	ExtDecoders map[string]Decoder
+
+	// Gap and Padding split Margin into the space between the images and
+	// the space around them; nil keeps Margin for that part.
+	Gap     *image.Point // horizontal and vertical gap between images
+	Padding *Insets      // space between the images and the sheet edges
+
+	// Images override options for single source files, keyed by file
+	// name. Positioned images are laid out like those of Previous.
+	Images map[string]ImageOptions
+
+	// Previous is the layout of an earlier build, e.g. from ParseManifest.
+	// Icons listed there at their current size keep their position, the
+	// others are packed into the free space or below, ignoring Layout.
+	Previous []Region
+
+	Dedupe        bool  // pack pixel-identical images once and point every class at it
+	Retina        bool  // pair <name>@2x files with <name> and build @2x sheets
+	Densities     []int // sources are at the largest of these pixel densities; pack them at 1x and add an @<d>x sheet per other one
+	Trim          bool  // crop transparent borders before packing
+	TrimThreshold uint8 // alpha at or below this value counts as transparent
+	Jobs          int   // parallel decode and trim workers, defaults to runtime.NumCPU()
+	LowMemory     bool  // read only dimensions up front and decode each image while drawing it
+	DryRun        bool  // lay out only: sheets get an Image with bounds but no pixels, and no Data
+	Strict        bool  // fail when any file cannot be read instead of leaving it out
+	Decoders      Pool  // decode budget shared with other Generators, nil means only Jobs applies
+
+	// Progress, when set, is called as every stage advances; see Progress.
+	Progress func(Progress)
+
+	// Logger receives the progress of a run at debug level and, once it
+	// is done, every warning and unreadable file. Nil logs nothing.
+	Logger *slog.Logger
+
+	Sort string // packing order: SortName, SortSize or SortArea
+
+	// Animation is what happens to animated gifs: AnimationFirstFrame packs
+	// only the first frame, AnimationSkip leaves them out and AnimationStrip
+	// packs all frames side by side, see Icon.Frames. Empty means the first
+	// frame with a warning.
+	Animation string
+
+	ClassPrefix   string // exposed to ClassTemplate as .Prefix
+	ClassTemplate string // text/template over .Prefix, .Name, .Base, .Ext, .Dir and .File with slug and lower
+	OnCollision   string // sources rendering the same class: CollisionError, CollisionSuffix or CollisionSkip
+
+	CSSTemplate  string // text/template source replacing CSS, executed with TemplateData
+	HTMLTemplate string // text/template source replacing DemoHTML, executed with TemplateData
+
+	// Variants are derived from every icon and packed next to the sources,
+	// see ParseVariant.
+	Variants []Variant
+
+	States    bool // pair <name>--hover, --active and --disabled files with <name> and emit pseudo-class rules
+	Keyframes bool // add @keyframes animations for numbered sequences like walk_001.png and gif strips
+	FPS       int  // frame rate of numbered sequences, 0 for 12
+
+	Embed    bool   // inline the sheets into the stylesheets as data uris
+	URLBase  string // prefix of sheet urls, e.g. "../img/" or a cdn; defaults to "/"
+	Inset    int    // grow every css icon box by this many px on each side
+	Anchor   string // AnchorTopLeft or AnchorBottomRight
+	DemoA11y bool   // annotate demo markup for assistive technology
+
+	Formats  []string // extra outputs, see FormatNames
+	Manifest bool     // include <name>.json, or those of ManifestFormats, in Files
+	DebugSVG bool     // include <sheet>.debug.svg in Files
+	Base64   bool     // include <sheet>.png.b64 in Files
+
+	// ManifestFormats are the manifests Manifest includes, <name>.<format>
+	// for ManifestJSON, ManifestCSV and ManifestYAML. Empty means json.
+	ManifestFormats []string
+
+	// GoPackage names the package of the "go" format, which defaults to
+	// the Name when that is a valid one and to sprite otherwise.
+	GoPackage string
+}
+
+// DefaultOptions returns the options used by the command line tool when no
+// flags are given.
+func DefaultOptions() Options {
+	return Options{
+		Src:               "./",
+		Extensions:        append([]string(nil), defaultExtensions...),
+		Name:              "sprite",
+		Sort:              SortName,
+		Layout:            LayoutVertical,
+		Margin:            4,
+		SheetNameTemplate: "{{ .Name }}_{{ .Index }}",
+		OutputFormat:      "png",
+		Jobs:              runtime.NumCPU(),
+		Anchor:            AnchorTopLeft,
+		URLBase:           "/",
+		ClassPrefix:       "icon-",
+		ClassTemplate:     "{{ .Prefix }}{{ .Name | slug }}",
+	}
+}
+
+// Icon is one source image and where it ended up.
+type Icon struct {
+	Name       string          // source file name, slash separated within Src with Recursive, e.g. "save.png" or "ui/save.png"
+	Class      string          // css class, see ClassName
+	Aliases    []string        // further classes from ImageOptions.Aliases
+	Sheet      int             // index into Result.Sheets
+	Rect       image.Rectangle // area the image occupies in its sheet
+	Cell       image.Rectangle // reserved cell, equal to Rect without CellAspect
+	TrimOffset image.Point     // offset of Rect's content within the untrimmed source
+	SourceSize image.Point     // size of the source before trimming
+	Source     image.Image     // decoded (and trimmed) source image, nil with LowMemory
+	Retina     image.Image     // matching @2x source when Options.Retina is set
+	dense      image.Image     // full resolution source with Options.Densities
+
+	// State is "hover", "active" or "disabled" for a <name>--<state> file
+	// paired with Options.States, and States are the icons paired with this
+	// one that way, in that order.
+	State  string
+	States []*Icon
+
+	// Frames are the frames of an animated source packed as a strip with
+	// AnimationStrip, nil for still images.
+	Frames []Frame
+
+	// DuplicateOf is the icon whose pixels this one shares with Dedupe. The
+	// duplicate is not drawn again, it takes the original's placement.
+	DuplicateOf *Icon
+
+	path    string // source file, for decoding it again with LowMemory
+	stateOf *Icon  // the icon this is the State of
+}
+
+// Path is the source file the icon was read from, which for a Variant is
+// the file it was derived from.
+func (icon *Icon) Path() string {
+	return icon.path
+}
+
+// size is the size the icon is packed at: that of the trimmed source, or
+// SourceSize before the source is decoded with LowMemory.
+func (icon *Icon) size() image.Point {
+	if icon.Source == nil {
+		return icon.SourceSize
+	}
+	return icon.Source.Bounds().Size()
+}
+
+// Sheet is one packed output image.
+type Sheet struct {
+	Index    int
+	Filename string
+	Image    *image.NRGBA
+	Format   string // Options.OutputFormat the sheet was encoded in
+	Data     []byte // encoded sheet, for png with only the essential chunks
+	Icons    []*Icon
+}
+
+// Result is everything Generate produced. Icons are in packing order.
+type Result struct {
+	Sheets   []*Sheet
+	Retina   []*Sheet // @2x copies of Sheets, index for index, with Options.Retina
+	Icons    []*Icon
+	Warnings []string // notices about the run, and files skipped in unsupported formats
+	Errors   []string // files that could not be read and are missing from the sheets
+
+	// Scaled are the copies of Sheets at every Options.Densities entry
+	// above 1, lowest first.
+	Scaled []DensitySheets
+
+	// Animations step through numbered sequences and gif strips with
+	// Options.Keyframes.
+	Animations []*Animation
+
+	opts    Options
+	cssTpl  *template.Template
+	htmlTpl *template.Template
+
+	// for Stats
+	inputBytes int64
+	phases     []PhaseTime
+}
+
+// Generator runs the pipeline for one set of options.
+type Generator struct {
+	opts    Options
+	gap     image.Point // between slots, from Gap or Margin
+	padding Insets      // around the packed area, from Padding or Margin
+	packer  Packer
+	filter  *regexp.Regexp
+	encoder Encoder
+	tpl     *template.Template
+	class   *template.Template
+	css     *template.Template
+	html    *template.Template
+
+	ctx context.Context // of the running Generate
+
+	// Options.ExtDecoders keyed like decoders, by lower-case extension
+	extDecoders map[string]Decoder
+
+	keepChunks map[string]bool // Options.KeepPNGChunks
+
+	// Options.URLs fetched by the running Generate, by url
+	fetched map[string]remoteSource
+
+	progressMu sync.Mutex
+	decodedN   int
+	encodedN   int
+
+	mu         sync.Mutex
+	icons      []*Icon
+	duplicates []*Icon
+	warnings   []string
+	errors     []string
+	readErrs   []error // the errors behind errors
+}
+
+// NewGenerator validates opts and fills in defaults for zero values. Options
+// it rejects are reported as an *OptionsError.
+func NewGenerator(opts Options) (*Generator, error) {
+	g, err := newGenerator(opts)
+	if err != nil {
+		return nil, &OptionsError{err}
+	}
+	return g, nil
+}
+
+func newGenerator(opts Options) (*Generator, error) {
+	if opts.Name == "" {
+		opts.Name = "sprite"
+	}
+	if opts.Src == "" {
+		opts.Src = "./"
+	}
+	if opts.Jobs < 1 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	if opts.Anchor == "" {
+		opts.Anchor = AnchorTopLeft
+	}
+	if opts.SheetNameTemplate == "" {
+		opts.SheetNameTemplate = DefaultOptions().SheetNameTemplate
+	}
+	if opts.OutputFormat == "" {
+		opts.OutputFormat = DefaultOptions().OutputFormat
+	}
+	if opts.URLBase == "" {
+		opts.URLBase = DefaultOptions().URLBase
+	} else if !strings.HasSuffix(opts.URLBase, "/") {
+		opts.URLBase += "/"
+	}
+	if opts.ClassTemplate == "" {
+		// an empty prefix only sticks together with a template of its own
+		if opts.ClassPrefix == "" {
+			opts.ClassPrefix = DefaultOptions().ClassPrefix
+		}
+		opts.ClassTemplate = DefaultOptions().ClassTemplate
+	}
+
+	switch opts.Sort {
+	case "":
+		opts.Sort = SortName
+	case SortName, SortSize, SortArea:
+	default:
+		return nil, fmt.Errorf("invalid sort %q, expected %s, %s or %s", opts.Sort, SortName, SortSize, SortArea)
+	}
+
+	switch opts.OnCollision {
+	case "":
+		opts.OnCollision = CollisionError
+	case CollisionError, CollisionSuffix, CollisionSkip:
+	default:
+		return nil, fmt.Errorf("invalid on-collision %q, expected %s, %s or %s", opts.OnCollision, CollisionError, CollisionSuffix, CollisionSkip)
+	}
+
+	if opts.Anchor != AnchorTopLeft && opts.Anchor != AnchorBottomRight {
+		return nil, fmt.Errorf("invalid anchor %q, expected %s or %s", opts.Anchor, AnchorTopLeft, AnchorBottomRight)
+	}
+	if opts.CellAspect.X < 0 || opts.CellAspect.Y < 0 || (opts.CellAspect.X == 0) != (opts.CellAspect.Y == 0) {
+		return nil, fmt.Errorf("invalid cell aspect %d:%d", opts.CellAspect.X, opts.CellAspect.Y)
+	}
+	encoder, ok := lookupEncoder(opts.OutputFormat)
+	if !ok {
+		return nil, fmt.Errorf("no encoder for output format %q", opts.OutputFormat)
+	}
+	if opts.Quality != 0 {
+		if opts.OutputFormat != "jpeg" && opts.OutputFormat != "jpg" {
+			return nil, fmt.Errorf("quality only applies to jpeg output, not %s", opts.OutputFormat)
+		}
+		if opts.Quality < 1 || opts.Quality > 100 {
+			return nil, fmt.Errorf("invalid jpeg quality %d, expected 1-100", opts.Quality)
+		}
+		encoder = jpegEncoder(opts.Quality)
+	}
+	if opts.Compression != png.DefaultCompression {
+		if opts.OutputFormat != "png" {
+			return nil, fmt.Errorf("png compression only applies to png output, not %s", opts.OutputFormat)
+		}
+		if opts.Compression < png.BestCompression || opts.Compression > png.NoCompression {
+			return nil, fmt.Errorf("invalid png compression level %d", opts.Compression)
+		}
+		encoder = pngEncoder(opts.Compression)
+	}
+	for _, kind := range opts.KeepPNGChunks {
+		if opts.OutputFormat != "png" {
+			return nil, fmt.Errorf("png chunks only apply to png output, not %s", opts.OutputFormat)
+		}
+		if !pngChunkType.MatchString(kind) {
+			return nil, fmt.Errorf("invalid png chunk %q, expected an ancillary chunk type such as pHYs or iCCP", kind)
+		}
+	}
+	if opts.Quantize != 0 {
+		if opts.OutputFormat != "png" {
+			return nil, fmt.Errorf("quantizing only applies to png output, not %s", opts.OutputFormat)
+		}
+		if opts.Quantize < 2 || opts.Quantize > 256 {
+			return nil, fmt.Errorf("invalid palette size %d, expected 2-256", opts.Quantize)
+		}
+	}
+	switch opts.Dither {
+	case "":
+		opts.Dither = DitherFloydSteinberg
+	case DitherFloydSteinberg, DitherNone:
+	default:
+		return nil, fmt.Errorf("invalid dither %q, expected %s or %s", opts.Dither, DitherFloydSteinberg, DitherNone)
+	}
+	if opts.Background == nil && opaqueFormats[opts.OutputFormat] {
+		opts.Background = color.White
+	}
+	for _, pattern := range opts.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+	for _, format := range opts.Formats {
+		if _, ok := formatRenderers[format]; !ok {
+			return nil, fmt.Errorf("unknown format %q", format)
+		}
+	}
+	for _, format := range opts.ManifestFormats {
+		if format != ManifestJSON && format != ManifestCSV && format != ManifestYAML {
+			return nil, fmt.Errorf("invalid manifest format %q, expected %s, %s or %s", format, ManifestJSON, ManifestCSV, ManifestYAML)
+		}
+	}
+	for _, rawURL := range opts.URLs {
+		if urlName(rawURL) == "" {
+			return nil, fmt.Errorf("invalid url %q, expected an http or https url of a file", rawURL)
+		}
+	}
+	if opts.GoPackage != "" && (!token.IsIdentifier(opts.GoPackage) || opts.GoPackage == "_") {
+		return nil, fmt.Errorf("invalid go package name %q", opts.GoPackage)
+	}
+
+	packer := opts.Packer
+	if packer == nil {
+		var err error
+		if packer, err = packerFor(opts.Layout, opts.Columns); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Resize.X < 0 || opts.Resize.Y < 0 || (opts.Resize.X == 0) != (opts.Resize.Y == 0) {
+		return nil, fmt.Errorf("invalid resize %dx%d", opts.Resize.X, opts.Resize.Y)
+	}
+	switch opts.ResizeMode {
+	case "":
+		opts.ResizeMode = ResizeFit
+	case ResizeFit, ResizeFill, ResizePad:
+	default:
+		return nil, fmt.Errorf("invalid resize mode %q, expected %s, %s or %s", opts.ResizeMode, ResizeFit, ResizeFill, ResizePad)
+	}
+	if opts.ResizeFilter == "" {
+		opts.ResizeFilter = FilterCatmullRom
+	}
+	if _, ok := resampleFilters[opts.ResizeFilter]; !ok && opts.ResizeFilter != FilterNearest {
+		return nil, fmt.Errorf("invalid resize filter %q, expected %s, %s, %s or %s", opts.ResizeFilter, FilterNearest, FilterBilinear, FilterCatmullRom, FilterLanczos)
+	}
+	switch opts.Animation {
+	case "", AnimationFirstFrame, AnimationSkip:
+	case AnimationStrip:
+		if opts.LowMemory {
+			return nil, fmt.Errorf("low memory mode cannot be combined with animation strips")
+		}
+	default:
+		return nil, fmt.Errorf("invalid animation %q, expected %s, %s or %s", opts.Animation, AnimationFirstFrame, AnimationSkip, AnimationStrip)
+	}
+	if opts.LowMemory && (opts.Trim || opts.Dedupe || opts.Retina || len(opts.Variants) > 0 || opts.Resize != image.ZP || len(opts.Densities) > 0) {
+		return nil, fmt.Errorf("low memory mode cannot be combined with trim, dedupe, retina, variants, resize or densities, they need every image decoded up front")
+	}
+	if len(opts.Densities) > 0 {
+		densities := append([]int(nil), opts.Densities...)
+		sort.Ints(densities)
+		opts.Densities = densities[:0]
+		for _, d := range densities {
+			if d < 1 {
+				return nil, fmt.Errorf("invalid pixel density %d", d)
+			}
+			if len(opts.Densities) == 0 || opts.Densities[len(opts.Densities)-1] != d {
+				opts.Densities = append(opts.Densities, d)
+			}
+		}
+		if opts.Retina {
+			return nil, fmt.Errorf("retina pairs @2x files, it cannot be combined with densities, which scale the sources down")
+		}
+		if opts.Animation == AnimationStrip {
+			return nil, fmt.Errorf("animation strips cannot be combined with densities")
+		}
+	}
+	gap := image.Pt(opts.Margin, opts.Margin)
+	if opts.Gap != nil {
+		gap = *opts.Gap
+	}
+	padding := UniformInsets(opts.Margin)
+	if opts.Padding != nil {
+		padding = *opts.Padding
+	}
+	if gap.X < 0 || gap.Y < 0 || padding.Top < 0 || padding.Right < 0 || padding.Bottom < 0 || padding.Left < 0 {
+		return nil, fmt.Errorf("negative margin or padding")
+	}
+	if opts.Extrude < 0 || 2*opts.Extrude > minInt(gap.X, gap.Y) {
+		return nil, fmt.Errorf("extruding %d px needs a gap of at least %d between images", opts.Extrude, 2*opts.Extrude)
+	}
+	if opts.Extrude > minInt(minInt(padding.Top, padding.Bottom), minInt(padding.Left, padding.Right)) {
+		return nil, fmt.Errorf("extruding %d px needs a padding of at least %d", opts.Extrude, opts.Extrude)
+	}
+	if opts.FPS < 0 {
+		return nil, fmt.Errorf("invalid frame rate %d", opts.FPS)
+	}
+	if opts.MaxWidth < 0 || opts.MaxHeight < 0 {
+		return nil, fmt.Errorf("invalid max sheet size %dx%d", opts.MaxWidth, opts.MaxHeight)
+	}
+	positioned := false
+	for name, o := range opts.Images {
+		if o.Padding < 0 {
+			return nil, fmt.Errorf("%s: negative padding", name)
+		}
+		if o.Position != nil && (o.Position.X < 0 || o.Position.Y < 0) {
+			return nil, fmt.Errorf("%s: negative position %v", name, *o.Position)
+		}
+		for _, alias := range o.Aliases {
+			if !cssIdent.MatchString(alias) {
+				return nil, fmt.Errorf("%s: alias %q is not a valid css class", name, alias)
+			}
+		}
+		positioned = positioned || o.Position != nil
+	}
+	if (opts.Previous != nil || positioned) && (opts.MaxRows > 0 || opts.MaxWidth > 0 || opts.MaxHeight > 0 || opts.CellAspect != image.ZP) {
+		return nil, fmt.Errorf("a previous layout or fixed positions cannot be combined with max rows, a max sheet size or cell aspect")
+	}
+	if opts.MaxRows > 0 && opts.Packer == nil {
+		switch {
+		case opts.Layout == LayoutGrid && opts.Columns <= 0:
+			return nil, fmt.Errorf("max rows with the grid layout needs an explicit column count")
+		case opts.Layout != "" && opts.Layout != LayoutVertical && opts.Layout != LayoutGrid:
+			return nil, fmt.Errorf("max rows is not supported by the %s layout", opts.Layout)
+		}
+	}
+
+	tpl, err := template.New("sheet-name").Option("missingkey=error").Parse(opts.SheetNameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sheet name template: %v", err)
+	}
+	classTpl, err := template.New("class").Funcs(classFuncs).Option("missingkey=error").Parse(opts.ClassTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid class template: %v", err)
+	}
+	cssTpl, err := parseOutputTemplate("css", opts.CSSTemplate)
+	if err != nil {
+		return nil, err
+	}
+	htmlTpl, err := parseOutputTemplate("html", opts.HTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		opts:    opts,
+		gap:     gap,
+		padding: padding,
+		packer:  packer,
+		filter:  extensionFilter(opts.Extensions),
+		tpl:     tpl,
+		class:   classTpl,
+		encoder: encoder,
+		css:     cssTpl,
+		html:    htmlTpl,
+	}
+	g.keepChunks = make(map[string]bool, len(opts.KeepPNGChunks))
+	for _, kind := range opts.KeepPNGChunks {
+		g.keepChunks[kind] = true
+	}
+	g.extDecoders = make(map[string]Decoder, len(opts.ExtDecoders))
+	for ext, decoder := range opts.ExtDecoders {
+		if decoder == nil {
+			return nil, fmt.Errorf("nil decoder for extension %q", ext)
+		}
+		g.extDecoders["."+canonicalExt(ext)] = decoder
+	}
+	return g, nil
+}
+
+// Generate is shorthand for NewGenerator(opts) followed by Generate.
+func Generate(opts Options) (*Result, error) {
+	g, err := NewGenerator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.Generate()
+}
+
+// GenerateContext is Generate, stopping early with the error of ctx once it
+// is done.
+func GenerateContext(ctx context.Context, opts Options) (*Result, error) {
+	g, err := NewGenerator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.GenerateContext(ctx)
+}
+
+// Generate decodes every matching image under Src and packs the sheets.
+// Files that cannot be decoded are left out and reported in Errors, or fail
+// the run with Strict.
+func (g *Generator) Generate() (*Result, error) {
+	return g.GenerateContext(context.Background())
+}
+
+// GenerateContext is Generate, checking ctx between files and between the
+// stages of the run. A decoder, encoder or optimizer already running is
+// waited for, every worker has stopped by the time it returns.
+func (g *Generator) GenerateContext(ctx context.Context) (*Result, error) {
+	g.ctx = ctx
+	start := time.Now()
+	imagenames, err := g.imagePaths(g.filter)
+	if err != nil {
+		return nil, err
+	}
+	imagenames = append(imagenames, g.opts.URLs...)
+
+	if len(imagenames) == 0 && !g.opts.AllowEmpty {
+		return nil, fmt.Errorf("%w in %s matching %s", ErrNoImages, g.opts.Src, strings.Join(g.opts.Extensions, ", "))
+	}
+	if g.opts.MaxImages > 0 && len(imagenames) > g.opts.MaxImages {
+		return nil, fmt.Errorf("%d files matched, more than the limit of %d; check the source directory, or narrow -extensions or widen -exclude", len(imagenames), g.opts.MaxImages)
+	}
+
+	g.icons = make([]*Icon, 0, len(imagenames))
+	g.duplicates = nil
+	g.warnings = nil
+	g.errors = nil
+	g.readErrs = nil
+	g.decodedN, g.encodedN = 0, 0
+
+	g.readImages(g.fetchURLs(imagenames))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.log().Debug("decoded sources", "files", len(imagenames), "unreadable", len(g.errors))
+
+	var inputBytes int64
+	for _, icon := range g.icons {
+		inputBytes += g.fileSize(icon.path)
+	}
+
+	// decoding finishes in arbitrary order, so fix it before any layout
+	sort.Slice(g.icons, func(a, b int) bool {
+		return g.icons[a].Name < g.icons[b].Name
+	})
+	sort.Strings(g.warnings)
+	sort.Strings(g.errors)
+	sort.Slice(g.readErrs, func(a, b int) bool {
+		return g.readErrs[a].Error() < g.readErrs[b].Error()
+	})
+
+	if g.opts.Strict && len(g.errors) > 0 {
+		msg := fmt.Sprintf("%d of %d files could not be read:\n%s", len(g.errors), len(imagenames), strings.Join(g.errors, "\n"))
+		return nil, &readErrors{msg, g.readErrs}
+	}
+
+	if g.opts.Retina {
+		g.pairRetina()
+	}
+
+	if g.opts.Resize != image.ZP {
+		g.resizeIcons()
+	}
+
+	if len(g.opts.Densities) > 0 {
+		g.downscaleIcons()
+	}
+
+	if len(g.opts.Variants) > 0 {
+		g.addVariants()
+	}
+
+	if err := g.nameIcons(); err != nil {
+		return nil, err
+	}
+
+	if g.opts.States {
+		g.pairStates()
+	}
+
+	if g.opts.Dedupe {
+		g.dedupeIcons()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.opts.Trim {
+		trimmed := make([]*Icon, 0, len(g.icons))
+		for _, icon := range g.icons {
+			if !g.opts.Images[icon.Name].NoTrim {
+				trimmed = append(trimmed, icon)
+			}
+		}
+		trimIcons(trimmed, g.opts.Jobs, g.opts.TrimThreshold)
+		for _, icon := range g.icons {
+			if icon.Retina != nil {
+				trimRetina(icon)
+			}
+			if icon.dense != nil {
+				trimDense(icon)
+			}
+		}
+	}
+
+	sortIcons(g.icons, g.opts.Sort)
+	if g.opts.States {
+		groupStates(g.icons)
+	}
+
+	result := &Result{
+		Icons:      g.icons,
+		Warnings:   g.warnings,
+		Errors:     g.errors,
+		opts:       g.opts,
+		inputBytes: inputBytes,
+		cssTpl:     g.css,
+		htmlTpl:    g.html,
+	}
+	phase := func(stage string) {
+		now := time.Now()
+		result.phases = append(result.phases, PhaseTime{stage, now.Sub(start)})
+		start = now
+	}
+	phase(StageDecode)
+
+	cell := cellSize(g.icons, g.opts.CellAspect)
+	if result.Sheets, err = g.splitSheets(cell); err != nil {
+		return nil, err
+	}
+
+	encodeTotal := g.encodeTotal(len(result.Sheets))
+	for _, sheet := range result.Sheets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		bounds := g.layout(sheet.Icons, cell)
+		if g.opts.DryRun {
+			// no pixels, but the sheet knows its size for the css
+			sheet.Image = &image.NRGBA{Rect: bounds}
+			sheet.Format = g.opts.OutputFormat
+			continue
+		}
+		if g.opts.LowMemory {
+			if sheet.Image, err = g.streamSprite(sheet.Icons, bounds); err != nil {
+				return nil, err
+			}
+		} else {
+			sheet.Image = fillInSprite(g.newSheet(bounds), sheet.Icons)
+		}
+		extrude(sheet.Image, sheet.Icons, g.opts.Extrude)
+		g.progress(StagePack, sheet.Index+1, len(result.Sheets))
+	}
+	phase(StagePack)
+	if g.opts.DryRun {
+		return g.finish(result), nil
+	}
+
+	for _, sheet := range result.Sheets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sheet.Format = g.opts.OutputFormat
+		if sheet.Data, err = g.encodeSheet(sheet.Image); err != nil {
+			return nil, err
+		}
+		g.encoded(encodeTotal)
+		g.log().Debug("encoded sheet", "sheet", sheet.Index, "icons", len(sheet.Icons), "width", sheet.Image.Bounds().Dx(), "height", sheet.Image.Bounds().Dy(), "bytes", len(sheet.Data))
+	}
+
+	if g.opts.Retina {
+		for _, sheet := range result.Sheets {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			retina, err := g.retinaSheet(sheet)
+			if err != nil {
+				return nil, err
+			}
+			g.encoded(encodeTotal)
+			result.Retina = append(result.Retina, retina)
+		}
+	}
+
+	if len(g.opts.Densities) > 0 {
+		if result.Scaled, err = g.densitySheets(result.Sheets, encodeTotal); err != nil {
+			return nil, err
+		}
+	}
+
+	phase(StageEncode)
+
+	if g.opts.Hash {
+		all := append(result.Sheets, result.Retina...)
+		for _, set := range result.Scaled {
+			all = append(all, set.Sheets...)
+		}
+		for _, sheet := range all {
+			sheet.Filename = hashedFilename(sheet.Filename, sheet.Data)
+		}
+	}
+
+	return g.finish(result), nil
+}
+
+// finish places the duplicates and animations of a packed result and
+// collects the warnings.
+func (g *Generator) finish(result *Result) *Result {
+	g.resolveDuplicates(result)
+
+	if g.opts.Keyframes {
+		result.Animations = g.animations(result.Icons)
+	}
+
+	// the layout and the animations add warnings of their own
+	result.Warnings = g.warnings
+	g.logNotices(result.Warnings, result.Errors)
+	return result
+}
+
+// Inputs lists the files Generate reads, for callers deciding whether a
+// previous result is still current.
+func (g *Generator) Inputs() ([]string, error) {
+	return g.imagePaths(g.filter)
+}
+
+func (g *Generator) imagePaths(filter *regexp.Regexp) (imagenames []string, err error) {
+	if g.opts.Recursive {
+		return g.walkImagePaths(filter)
+	}
+
+	var filenames []string
+	if g.opts.FS != nil {
+		filenames, err = fs.Glob(g.opts.FS, path.Join(g.opts.Src, "*"))
+	} else {
+		var absPath string
+		if absPath, err = filepath.Abs(g.opts.Src); err != nil {
+			return nil, err
+		}
+		filenames, err = filepath.Glob(filepath.Join(absPath, "*"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, x := range filenames {
+		if filter.MatchString(x) && !g.excluded(filepath.Base(x)) {
+			imagenames = append(imagenames, x)
+		}
+	}
+
+	return
+}
+
+// walkImagePaths is imagePaths for every directory below Src. Hidden
+// directories like .git are passed over, and so are those Exclude matches.
+func (g *Generator) walkImagePaths(filter *regexp.Regexp) (imagenames []string, err error) {
+	var root string
+	visit := func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if p != root && (strings.HasPrefix(entry.Name(), ".") || g.excluded(entry.Name())) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filter.MatchString(p) && !g.excluded(entry.Name()) {
+			imagenames = append(imagenames, p)
+		}
+		return nil
+	}
+
+	if g.opts.FS != nil {
+		root = path.Clean(g.opts.Src)
+		err = fs.WalkDir(g.opts.FS, root, visit)
+	} else if root, err = filepath.Abs(g.opts.Src); err == nil {
+		err = filepath.WalkDir(root, visit)
+	}
+	return
+}
+
+// iconName names source p by its slash separated path within Src, which
+// without Recursive is just its file name, and a url by its file name.
+func (g *Generator) iconName(p string) string {
+	if remote, ok := g.fetched[p]; ok {
+		return remote.name
+	}
+	if g.opts.FS != nil {
+		root := path.Clean(g.opts.Src)
+		if root == "." {
+			return p
+		}
+		return strings.TrimPrefix(p, root+"/")
+	}
+
+	root, err := filepath.Abs(g.opts.Src)
+	if err != nil {
+		return filepath.Base(p)
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.Base(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (g *Generator) excluded(filename string) bool {
+	for _, pattern := range g.opts.Exclude {
+		// patterns were validated in NewGenerator
+		if ok, _ := filepath.Match(pattern, filename); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) warn(format string, args ...interface{}) {
+	g.mu.Lock()
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+	g.mu.Unlock()
+}
+
+// log is Options.Logger, or one discarding everything without it.
+func (g *Generator) log() *slog.Logger {
+	if g.opts.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return g.opts.Logger
+}
+
+// logNotices hands the warnings and errors of a finished run to the
+// logger, sorted like Result has them rather than as the workers ran into
+// them.
+func (g *Generator) logNotices(warnings, failures []string) {
+	for _, w := range warnings {
+		g.log().Warn(w)
+	}
+	for _, e := range failures {
+		g.log().Error(e)
+	}
+}
+
+// fail records a file that could not be read, or only warns about one in
+// a format that is not supported.
+func (g *Generator) fail(err error) {
+	if errors.Is(err, errUnsupported) {
+		g.warn("%v", err)
+		return
+	}
+	g.mu.Lock()
+	g.errors = append(g.errors, err.Error())
+	g.readErrs = append(g.readErrs, err)
+	g.mu.Unlock()
+}
+
+func extensionFilter(extensions []string) *regexp.Regexp {
+	var exts []string
+	for _, ext := range extensions {
+		ext = canonicalExt(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		exts = append(exts, regexp.QuoteMeta(ext))
+		for alias, canonical := range extAliases {
+			if canonical == ext {
+				exts = append(exts, regexp.QuoteMeta(alias))
+			}
+		}
+	}
+	sort.Strings(exts)
+
+	if len(exts) == 0 {
+		return regexp.MustCompile(`^$`)
+	}
+	return regexp.MustCompile(".*\\.(?i:" + strings.Join(exts, "|") + ")$")
+}
@@ -0,0 +1,22 @@
+package spritify
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaxImagesNamesTheFilters(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Src = filepath.Join("testdata", "golden", "src")
+	opts.MaxImages = 2
+	_, err := Generate(opts)
+	if err == nil {
+		t.Fatal("Generate packed more than MaxImages files")
+	}
+	for _, flag := range []string{"-extensions", "-exclude"} {
+		if !strings.Contains(err.Error(), flag) {
+			t.Errorf("error %q does not mention %s", err, flag)
+		}
+	}
+}
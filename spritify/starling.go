@@ -0,0 +1,30 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Starling renders a <sheet>.xml per sheet in the TextureAtlas format of
+// Starling and Sparrow. Trimmed icons carry the frame attributes that
+// restore their source size.
+func (r *Result) Starling() []File {
+	files := make([]File, 0, len(r.Sheets))
+	for _, sheet := range r.Sheets {
+		var buf bytes.Buffer
+		buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		fmt.Fprintf(&buf, "<TextureAtlas imagePath=\"%s\">\n", xmlEscape(sheet.Filename))
+		for _, icon := range sheet.Icons {
+			f := newTPFrame(icon)
+			fmt.Fprintf(&buf, "  <SubTexture name=\"%s\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"", xmlEscape(icon.Name), f.Frame.X, f.Frame.Y, f.Frame.W, f.Frame.H)
+			if f.Trimmed {
+				fmt.Fprintf(&buf, " frameX=\"%d\" frameY=\"%d\" frameWidth=\"%d\" frameHeight=\"%d\"", -f.SpriteSourceSize.X, -f.SpriteSourceSize.Y, f.SourceSize.W, f.SourceSize.H)
+			}
+			buf.WriteString("/>\n")
+		}
+		buf.WriteString("</TextureAtlas>\n")
+
+		files = append(files, File{sheetBase(sheet) + ".xml", buf.Bytes()})
+	}
+	return files
+}
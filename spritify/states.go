@@ -0,0 +1,123 @@
+package spritify
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// stateSelectors maps the state suffix of a file name, as in
+// save--hover.png, to the pseudo-class its rule is emitted for. States
+// are listed in css order, so disabled wins over a hover on the same
+// element.
+var stateSelectors = []struct {
+	state    string
+	selector string
+}{
+	{"hover", ":hover"},
+	{"active", ":active"},
+	{"disabled", ":disabled"},
+}
+
+var stateName = regexp.MustCompile(`^(.+)--(hover|active|disabled)$`)
+
+func stateRank(state string) int {
+	for idx, s := range stateSelectors {
+		if s.state == state {
+			return idx
+		}
+	}
+	return len(stateSelectors)
+}
+
+// pairStates attaches every "<name>--<state>.<ext>" icon to the icon of
+// "<name>.<ext>". A state without its base image is packed as a plain icon
+// with a warning.
+func (g *Generator) pairStates() {
+	byName := make(map[string]*Icon, len(g.icons))
+	for _, icon := range g.icons {
+		byName[icon.Name] = icon
+	}
+
+	for _, icon := range g.icons {
+		match := stateName.FindStringSubmatch(iconKey(icon.Name))
+		if match == nil {
+			continue
+		}
+		base, ok := byName[match[1]+filepath.Ext(icon.Name)]
+		if !ok {
+			g.warn("%s: no %s%s to be the %s state of", icon.path, match[1], filepath.Ext(icon.Name), match[2])
+			continue
+		}
+		icon.State, icon.stateOf = match[2], base
+		base.States = append(base.States, icon)
+	}
+
+	for _, icon := range g.icons {
+		sort.SliceStable(icon.States, func(a, b int) bool {
+			return stateRank(icon.States[a].State) < stateRank(icon.States[b].State)
+		})
+	}
+}
+
+// groupStates moves the states of every icon right behind it, so the
+// ordered layouts pack them next to each other.
+func groupStates(icons []*Icon) {
+	listed := make(map[*Icon]bool, len(icons))
+	for _, icon := range icons {
+		listed[icon] = true
+	}
+
+	grouped := make([]*Icon, 0, len(icons))
+	for _, icon := range icons {
+		// states of an icon packed elsewhere, e.g. a duplicate, stay put
+		if icon.stateOf != nil && listed[icon.stateOf] {
+			continue
+		}
+		grouped = append(grouped, icon)
+		for _, state := range icon.States {
+			if listed[state] {
+				grouped = append(grouped, state)
+			}
+		}
+	}
+	copy(icons, grouped)
+}
+
+// stateRules renders the pseudo-class rules showing the states of icon in
+// its place.
+func (r *Result) stateRules(icon *Icon, uniform bool) []string {
+	pad := r.opts.Inset
+	rules := make([]string, 0, len(icon.States))
+
+	for _, state := range icon.States {
+		sheet := r.Sheets[state.Sheet]
+		bgImage := ""
+		if state.Sheet != icon.Sheet && !r.opts.Embed {
+			bgImage = fmt.Sprintf(` background-image: url("%s");`, r.sheetURL(sheet))
+		}
+
+		box := state.Rect.Inset(-pad)
+		selector := icon.selector(stateSelectors[stateRank(state.State)].selector)
+		if uniform || state.Rect.Size() == icon.Rect.Size() {
+			rules = append(rules, fmt.Sprintf("%s {%s background-position: %s;}", selector, bgImage, r.backgroundPosition(box, sheet.Image.Bounds())))
+		} else {
+			rules = append(rules, fmt.Sprintf("%s {%s background-position: %s; width:%dpx; height:%dpx;}", selector, bgImage, r.backgroundPosition(box, sheet.Image.Bounds()), box.Dx(), box.Dy()))
+		}
+	}
+
+	return rules
+}
+
+// stateSelectorsOn lists the pseudo-class selectors of the states packed on
+// sheet, for the rules that give every sheet's icons their image.
+func (r *Result) stateSelectorsOn(sheet *Sheet) []string {
+	var selectors []string
+	for _, icon := range sheet.Icons {
+		if icon.stateOf != nil {
+			selectors = append(selectors, icon.stateOf.selector(stateSelectors[stateRank(icon.State)].selector))
+		}
+	}
+	return selectors
+}
@@ -0,0 +1,110 @@
+package spritify
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Stats summarize a run, see Result.Stats.
+type Stats struct {
+	Icons       int          `json:"icons"`
+	Sheets      []SheetStats `json:"sheets"`
+	Efficiency  float64      `json:"efficiency"`   // image pixels over sheet pixels, 0 to 1
+	InputBytes  int64        `json:"input_bytes"`  // size of the source files packed
+	SpriteBytes int64        `json:"sprite_bytes"` // encoded sheets with their @2x and density copies
+	Phases      []PhaseTime  `json:"phases"`
+}
+
+// SheetStats describe one sheet of Stats.
+type SheetStats struct {
+	Filename   string  `json:"file"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Icons      int     `json:"icons"`
+	Bytes      int     `json:"bytes"`
+	Efficiency float64 `json:"efficiency"`
+}
+
+// PhaseTime is how long one stage of Generate took, named like
+// Progress.Stage.
+type PhaseTime struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"ns"`
+}
+
+// Stats collects the numbers worth watching across builds: how well the
+// sheets are filled, how the encoded sprite compares to its sources and
+// where the time went.
+func (r *Result) Stats() Stats {
+	stats := Stats{Icons: len(r.Icons), InputBytes: r.inputBytes, Phases: r.phases}
+
+	var used, total int
+	for _, sheet := range r.Sheets {
+		b := sheet.Image.Bounds()
+		area := 0
+		for _, icon := range sheet.Icons {
+			if icon.DuplicateOf == nil {
+				area += icon.Rect.Dx() * icon.Rect.Dy()
+			}
+		}
+		stats.Sheets = append(stats.Sheets, SheetStats{
+			Filename:   sheet.Filename,
+			Width:      b.Dx(),
+			Height:     b.Dy(),
+			Icons:      len(sheet.Icons),
+			Bytes:      len(sheet.Data),
+			Efficiency: ratio(area, b.Dx()*b.Dy()),
+		})
+		used += area
+		total += b.Dx() * b.Dy()
+		stats.SpriteBytes += int64(len(sheet.Data))
+	}
+	stats.Efficiency = ratio(used, total)
+
+	for _, sheet := range r.Retina {
+		stats.SpriteBytes += int64(len(sheet.Data))
+	}
+	for _, set := range r.Scaled {
+		for _, sheet := range set.Sheets {
+			stats.SpriteBytes += int64(len(sheet.Data))
+		}
+	}
+	return stats
+}
+
+// JSON renders s indented, for a file next to the build logs.
+func (s Stats) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func ratio(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// fileSize is the size of source p on Options.FS or the OS filesystem, 0
+// when it cannot be told.
+func (g *Generator) fileSize(p string) int64 {
+	if remote, ok := g.fetched[p]; ok {
+		return int64(len(remote.data))
+	}
+	var info fs.FileInfo
+	var err error
+	if g.opts.FS != nil {
+		info, err = fs.Stat(g.opts.FS, p)
+	} else {
+		info, err = os.Stat(p)
+	}
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
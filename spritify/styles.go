@@ -0,0 +1,93 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+)
+
+// preprocessor variable syntax per Options.Formats value
+var styleVarPrefix = map[string]string{
+	"scss": "$",
+	"less": "@",
+}
+
+// sheetURL is how the stylesheets reference sheet: its file name under
+// Options.URLBase, or the whole sheet as a data uri with Options.Embed.
+func (r *Result) sheetURL(sheet *Sheet) string {
+	if r.opts.Embed {
+		return "data:" + sheetMIME(sheet.Format) + ";base64," + base64.StdEncoding.EncodeToString(sheet.Data)
+	}
+	return r.opts.URLBase + sheet.Filename
+}
+
+// StyleSheet renders the stylesheet for a css preprocessor, "scss" or
+// "less". Both declare the sheet level variables, carrying the sheet index
+// when there are several sheets; scss also gets per icon maps and a mixin.
+func (r *Result) StyleSheet(format string) ([]byte, error) {
+	prefix, ok := styleVarPrefix[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// generated by gospritifulcss, do not edit\n")
+	for idx, sheet := range r.Sheets {
+		varName := prefix + "sprite"
+		if len(r.Sheets) > 1 {
+			varName = fmt.Sprintf("%s-%d", varName, idx)
+		}
+
+		fmt.Fprintf(&buf, "%s-url: %q;\n", varName, r.sheetURL(sheet))
+		fmt.Fprintf(&buf, "%s-width: %dpx;\n", varName, sheet.Image.Bounds().Dx())
+		fmt.Fprintf(&buf, "%s-height: %dpx;\n", varName, sheet.Image.Bounds().Dy())
+	}
+
+	if format == "scss" {
+		r.writeSCSSIcons(&buf)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// reserved by the sheet level variables
+var reservedSlugs = map[string]bool{"url": true, "width": true, "height": true}
+
+// writeSCSSIcons declares $sprite-<class> per icon and the $sprites map by
+// class, the classes of the css output after Options.OnCollision, so no
+// two icons share a variable or a key.
+func (r *Result) writeSCSSIcons(buf *bytes.Buffer) {
+	buf.WriteString("\n")
+	for _, icon := range r.Icons {
+		fmt.Fprintf(buf, "$sprite-%s: (x: %dpx, y: %dpx, width: %dpx, height: %dpx, url: %q);\n",
+			scssVarSlug(icon.ClassName()), icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy(), r.sheetURL(r.Sheets[icon.Sheet]))
+	}
+
+	buf.WriteString("\n$sprites: (\n")
+	for _, icon := range r.Icons {
+		fmt.Fprintf(buf, "  %s: $sprite-%s,\n", icon.ClassName(), scssVarSlug(icon.ClassName()))
+	}
+	buf.WriteString(");\n\n")
+
+	buf.WriteString(`@mixin sprite($name) {
+  $icon: map-get($sprites, $name);
+  @if not $icon {
+    @error "unknown sprite #{$name}";
+  }
+  background: url(map-get($icon, url)) no-repeat;
+  background-position: (map-get($icon, x) * -1) (map-get($icon, y) * -1);
+  width: map-get($icon, width);
+  height: map-get($icon, height);
+}
+`)
+}
+
+// scssVarSlug is the $sprite-<slug> suffix of class. Classes the sheet
+// level variables use are prefixed with "--", which no valid class starts
+// with.
+func scssVarSlug(class string) string {
+	if reservedSlugs[class] {
+		return "--" + class
+	}
+	return class
+}
@@ -0,0 +1,70 @@
+package spritify
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestSCSSUsesResolvedClasses(t *testing.T) {
+	src := t.TempDir()
+	writePNG(t, filepath.Join(src, "a.png"), image.Pt(4, 4), color.Black)
+	if err := os.Mkdir(filepath.Join(src, "x"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(src, "y"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(src, "x", "b.png"), image.Pt(4, 4), color.White)
+	writePNG(t, filepath.Join(src, "y", "b.png"), image.Pt(6, 6), color.White)
+
+	opts := DefaultOptions()
+	opts.Src = src
+	opts.Recursive = true
+	opts.ClassTemplate = "{{ .File | slug }}"
+	opts.OnCollision = CollisionSuffix
+
+	// the default of failing still applies
+	strict := opts
+	strict.OnCollision = ""
+	if _, err := Generate(strict); err == nil {
+		t.Fatal("x/b.png and y/b.png rendering the same class did not fail")
+	}
+
+	result, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scss, err := result.StyleSheet("scss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := regexp.MustCompile(`(?m)^\$sprite-(\S+): \(x:`).FindAllStringSubmatch(string(scss), -1)
+	keys := regexp.MustCompile(`(?m)^  (\S+): \$sprite-`).FindAllStringSubmatch(string(scss), -1)
+	if len(vars) != len(result.Icons) || len(keys) != len(result.Icons) {
+		t.Fatalf("%d variables and %d map keys for %d icons:\n%s", len(vars), len(keys), len(result.Icons), scss)
+	}
+	seen := make(map[string]bool)
+	for idx, icon := range result.Icons {
+		if keys[idx][1] != icon.ClassName() {
+			t.Errorf("map key %s, want the class %s", keys[idx][1], icon.ClassName())
+		}
+		if seen[vars[idx][1]] {
+			t.Errorf("$sprite-%s is declared twice", vars[idx][1])
+		}
+		seen[vars[idx][1]] = true
+	}
+}
+
+func TestSCSSReservedClass(t *testing.T) {
+	if got := scssVarSlug("url"); got != "--url" {
+		t.Errorf("scssVarSlug(url) = %s, want --url", got)
+	}
+	if got := scssVarSlug("save"); got != "save" {
+		t.Errorf("scssVarSlug(save) = %s, want save", got)
+	}
+}
@@ -0,0 +1,303 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SymbolSprite is an svg sprite: every svg source wrapped in a <symbol> of
+// one file, to be shown with <svg><use href="sprite.svg#id"/></svg>.
+type SymbolSprite struct {
+	Symbols []Symbol // sorted by source file name
+	Errors  []string // files that could not be read and are missing from the sprite
+
+	opts       Options
+	namespaces map[string]string // prefixes the sources declare on their root, to their uri
+}
+
+// Symbol is one svg source inside a SymbolSprite.
+type Symbol struct {
+	Name    string // source file name, e.g. "save.svg"
+	ID      string // symbol id, rendered by Options.ClassTemplate
+	ViewBox string
+	Content []byte // markup inside the source's root <svg> element
+
+	namespaces map[string]string // declared on the source's root, by prefix
+	ids        []string          // of the elements in Content, before prefixing
+}
+
+// GenerateSymbols is shorthand for NewGenerator(opts) followed by
+// GenerateSymbols.
+func GenerateSymbols(opts Options) (*SymbolSprite, error) {
+	g, err := NewGenerator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return g.GenerateSymbols()
+}
+
+// GenerateSymbols builds an svg symbol sprite from every .svg file under
+// Src, regardless of Extensions. Nothing is rasterized or packed; Exclude,
+// Name, ClassPrefix, ClassTemplate and DemoA11y apply as usual.
+func (g *Generator) GenerateSymbols() (*SymbolSprite, error) {
+	paths, err := g.SymbolInputs()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 && !g.opts.AllowEmpty {
+		return nil, fmt.Errorf("%w in %s matching svg", ErrNoImages, g.opts.Src)
+	}
+	sort.Strings(paths)
+
+	sprite := &SymbolSprite{opts: g.opts, namespaces: make(map[string]string)}
+	var readErrs []error
+	fail := func(err error) {
+		sprite.Errors = append(sprite.Errors, err.Error())
+		readErrs = append(readErrs, err)
+	}
+
+	var names, ids []string
+	for _, p := range paths {
+		name := g.iconName(p)
+		data, err := g.readFile(p)
+		if err != nil {
+			fail(&DecodeError{p, err})
+			continue
+		}
+
+		symbol, err := parseSymbol(data)
+		if err != nil {
+			fail(&DecodeError{p, fmt.Errorf("%v, skipping", err)})
+			continue
+		}
+		if prefix, ok := sprite.declare(symbol.namespaces); !ok {
+			fail(&DecodeError{p, fmt.Errorf("namespace prefix %s is bound to another uri by an earlier file, skipping", prefix)})
+			continue
+		}
+
+		// the class template picks symbol ids, so they match the css classes
+		id, err := g.className(name)
+		if err != nil {
+			return nil, err
+		}
+		names, ids = append(names, name), append(ids, id)
+
+		symbol.Name = name
+		sprite.Symbols = append(sprite.Symbols, symbol)
+	}
+
+	ids, err = g.uniqueClasses("symbol id", names, ids)
+	if err != nil {
+		return nil, err
+	}
+	symbols := sprite.Symbols[:0]
+	for i, symbol := range sprite.Symbols {
+		if ids[i] != "" {
+			symbol.ID = ids[i]
+			symbol.Content = prefixIDs(symbol.Content, symbol.ids, symbol.ID+"-")
+			symbols = append(symbols, symbol)
+		}
+	}
+	sprite.Symbols = symbols
+
+	if g.opts.Strict && len(sprite.Errors) > 0 {
+		msg := fmt.Sprintf("%d of %d files could not be read:\n%s", len(sprite.Errors), len(paths), strings.Join(sprite.Errors, "\n"))
+		return nil, &readErrors{msg, readErrs}
+	}
+
+	g.log().Debug("read symbols", "files", len(paths), "symbols", len(sprite.Symbols))
+	g.logNotices(g.warnings, sprite.Errors)
+	return sprite, nil
+}
+
+// SymbolInputs lists the files GenerateSymbols reads.
+func (g *Generator) SymbolInputs() ([]string, error) {
+	return g.imagePaths(extensionFilter([]string{"svg"}))
+}
+
+// declare adds namespaces to those of the sprite, failing with the prefix
+// when one is already bound to a different uri.
+func (s *SymbolSprite) declare(namespaces map[string]string) (string, bool) {
+	for prefix, uri := range namespaces {
+		if bound, ok := s.namespaces[prefix]; ok && bound != uri {
+			return prefix, false
+		}
+	}
+	for prefix, uri := range namespaces {
+		s.namespaces[prefix] = uri
+	}
+	return "", true
+}
+
+// parseSymbol takes the viewBox, namespace declarations and inner markup of
+// an svg document's root element, and the ids inside it. Without a viewBox
+// one is made from a unitless or px width and height.
+func parseSymbol(data []byte) (Symbol, error) {
+	symbol := Symbol{namespaces: make(map[string]string)}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root xml.StartElement
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return symbol, fmt.Errorf("no <svg> root element")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root = start
+			break
+		}
+	}
+	if root.Name.Local != "svg" {
+		return symbol, fmt.Errorf("root element is <%s>, not <svg>", root.Name.Local)
+	}
+
+	var width, height string
+	for _, attr := range root.Attr {
+		switch attr.Name.Local {
+		case "viewBox":
+			symbol.ViewBox = attr.Value
+		case "width":
+			width = strings.TrimSuffix(attr.Value, "px")
+		case "height":
+			height = strings.TrimSuffix(attr.Value, "px")
+		}
+		if attr.Name.Space == "xmlns" {
+			symbol.namespaces[attr.Name.Local] = attr.Value
+		}
+	}
+	if symbol.ViewBox == "" {
+		w, errW := strconv.ParseFloat(width, 64)
+		h, errH := strconv.ParseFloat(height, 64)
+		if errW != nil || errH != nil {
+			return symbol, fmt.Errorf("no viewBox and no usable width and height")
+		}
+		symbol.ViewBox = fmt.Sprintf("0 0 %g %g", w, h)
+	}
+
+	start := d.InputOffset()
+	for depth := 0; ; {
+		end := d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			return symbol, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range tok.Attr {
+				if attr.Name.Space == "" && attr.Name.Local == "id" {
+					symbol.ids = append(symbol.ids, attr.Value)
+				}
+			}
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				symbol.Content = bytes.TrimSpace(data[start:end])
+				return symbol, nil
+			}
+			depth--
+		}
+	}
+}
+
+var (
+	idAttr  = regexp.MustCompile(`(\sid\s*=\s*)("[^"]*"|'[^']*')`)
+	urlRef  = regexp.MustCompile(`(url\(\s*['"]?#)([^'")\s]+)`)
+	hrefRef = regexp.MustCompile(`(href\s*=\s*["']#)([^"']+)`)
+)
+
+// prefixIDs puts prefix before every one of ids in content, both where it
+// is defined and where url(#id), href="#id" or xlink:href="#id" refer to
+// it, so the ids of two symbols cannot clash. References to ids that
+// content does not define are left alone.
+func prefixIDs(content []byte, ids []string, prefix string) []byte {
+	if len(ids) == 0 {
+		return content
+	}
+	defined := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		defined[id] = true
+	}
+
+	content = idAttr.ReplaceAllFunc(content, func(m []byte) []byte {
+		sub := idAttr.FindSubmatch(m)
+		quote, value := sub[2][:1], sub[2][1:len(sub[2])-1]
+		if !defined[xmlUnescape(string(value))] {
+			return m
+		}
+		return bytes.Join([][]byte{sub[1], quote, []byte(xmlEscape(prefix)), value, quote}, nil)
+	})
+	for _, ref := range []*regexp.Regexp{urlRef, hrefRef} {
+		ref := ref
+		content = ref.ReplaceAllFunc(content, func(m []byte) []byte {
+			sub := ref.FindSubmatch(m)
+			if !defined[xmlUnescape(string(sub[2]))] {
+				return m
+			}
+			return bytes.Join([][]byte{sub[1], []byte(xmlEscape(prefix)), sub[2]}, nil)
+		})
+	}
+	return content
+}
+
+// xmlUnescape decodes the entities of an attribute value as written.
+func xmlUnescape(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	return html.UnescapeString(s)
+}
+
+// Filename is the name the symbol sprite is written under.
+func (s *SymbolSprite) Filename() string {
+	return s.opts.Name + ".svg"
+}
+
+// SVG renders the sprite, hidden when inlined into a page.
+func (s *SymbolSprite) SVG() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<svg xmlns="http://www.w3.org/2000/svg"`)
+	prefixes := make([]string, 0, len(s.namespaces))
+	for prefix := range s.namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(&buf, ` xmlns:%s="%s"`, prefix, xmlEscape(s.namespaces[prefix]))
+	}
+	buf.WriteString(` style="display:none">` + "\n")
+	for _, symbol := range s.Symbols {
+		fmt.Fprintf(&buf, `<symbol id="%s" viewBox="%s">%s</symbol>`+"\n", xmlEscape(symbol.ID), xmlEscape(symbol.ViewBox), symbol.Content)
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// DemoHTML renders a page showing every symbol through <use>.
+func (s *SymbolSprite) DemoHTML() []byte {
+	tags := make([]string, 0, len(s.Symbols))
+	for _, symbol := range s.Symbols {
+		href := html.EscapeString(s.Filename() + "#" + symbol.ID)
+		if s.opts.DemoA11y {
+			label := html.EscapeString(iconLabel(symbol.Name))
+			tags = append(tags, fmt.Sprintf(`<svg class="icon" width="32" height="32" role="img" aria-label="%s"><use href="%s"/></svg>`, label, href))
+		} else {
+			tags = append(tags, fmt.Sprintf(`<svg class="icon" width="32" height="32" aria-hidden="true"><use href="%s"/></svg>`, href))
+		}
+	}
+
+	return []byte(fmt.Sprintf(`<html><head></head><body>%s</body></html>`, strings.Join(tags, "")))
+}
+
+// Files renders the sprite and its demo page.
+func (s *SymbolSprite) Files() []File {
+	return []File{
+		{s.Filename(), s.SVG()},
+		{s.opts.Name + ".html", s.DemoHTML()},
+	}
+}
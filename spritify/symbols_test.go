@@ -0,0 +1,97 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gradientSVG = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 16 16">
+  <defs><linearGradient id="a"><stop offset="0" stop-color="#fff"/></linearGradient></defs>
+  <rect id="shape" width="16" height="16" fill="url(#a)"/>
+  <use xlink:href="#shape" href="#elsewhere"/>
+</svg>`
+
+func writeSources(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSymbolsPrefixIDs(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Src = writeSources(t, map[string]string{"one.svg": gradientSVG, "two.svg": gradientSVG})
+
+	sprite, err := GenerateSymbols(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := sprite.SVG()
+
+	// well formed, the xlink prefix declared on the sprite
+	d := xml.NewDecoder(bytes.NewReader(svg))
+	ids := make(map[string]int)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("sprite is not well formed: %v\n%s", err, svg)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "id" {
+					ids[attr.Value]++
+				}
+			}
+		}
+	}
+	if !bytes.Contains(svg, []byte(`xmlns:xlink="http://www.w3.org/1999/xlink"`)) {
+		t.Errorf("xlink namespace missing from the sprite root:\n%s", svg)
+	}
+	for id, n := range ids {
+		if n > 1 {
+			t.Errorf("id %q is defined %d times", id, n)
+		}
+	}
+
+	for _, symbol := range sprite.Symbols {
+		content := string(symbol.Content)
+		for _, want := range []string{
+			`id="` + symbol.ID + `-a"`,
+			`fill="url(#` + symbol.ID + `-a)"`,
+			`xlink:href="#` + symbol.ID + `-shape"`,
+			`href="#elsewhere"`,
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: %s missing from\n%s", symbol.Name, want, content)
+			}
+		}
+	}
+}
+
+func TestSymbolsStrictWrapsDecodeErrors(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Src = writeSources(t, map[string]string{"good.svg": gradientSVG, "bad.svg": "<html></html>"})
+	opts.Strict = true
+
+	_, err := GenerateSymbols(opts)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("error %v does not wrap a *DecodeError", err)
+	}
+	if filepath.Base(decodeErr.Path) != "bad.svg" {
+		t.Errorf("DecodeError is for %s, want bad.svg", decodeErr.Path)
+	}
+}
@@ -0,0 +1,134 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is what Options.CSSTemplate and Options.HTMLTemplate are
+// executed with.
+type TemplateData struct {
+	Name    string // Options.Name
+	CSSFile string // file name of the stylesheet, for linking it from the demo
+	Sheets  []TemplateSheet
+	Icons   []TemplateIcon // in packing order
+	Options Options
+
+	// Keyframes holds the @keyframes rules and animation classes of the
+	// built-in stylesheet with Options.Keyframes, empty otherwise.
+	Keyframes string
+}
+
+// TemplateSheet describes one packed sheet.
+type TemplateSheet struct {
+	Index    int
+	Filename string
+	URL      string // as referenced by the built-in stylesheet
+	Width    int
+	Height   int
+}
+
+// TemplateIcon describes where one icon ended up.
+type TemplateIcon struct {
+	Name   string // source file name, e.g. "save.png"
+	Base   string // Name without its extension
+	Class  string // rendered by Options.ClassTemplate
+	Sheet  int    // index into TemplateData.Sheets
+	X      int
+	Y      int
+	Width  int
+	Height int
+
+	// BackgroundPosition is the value of the background-position property,
+	// honouring Options.Anchor and Options.Inset like the built-in rules.
+	BackgroundPosition string
+
+	// Aliases are the further classes of ImageOptions.Aliases.
+	Aliases []string
+}
+
+// templateFuncs are available to the output templates on top of the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"slug":  classSlug,
+	"lower": classFuncs["lower"],
+}
+
+func parseOutputTemplate(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return tpl, nil
+}
+
+// TemplateData collects the sheets and icons in the form handed to custom
+// output templates.
+func (r *Result) TemplateData() TemplateData {
+	data := TemplateData{
+		Name:    r.opts.Name,
+		CSSFile: r.CSSFilename(),
+		Options: r.opts,
+	}
+	if blocks := r.keyframesCSS(); len(blocks) > 0 {
+		data.Keyframes = strings.Join(blocks, "\n") + "\n"
+	}
+
+	for _, sheet := range r.Sheets {
+		b := sheet.Image.Bounds()
+		data.Sheets = append(data.Sheets, TemplateSheet{
+			Index:    sheet.Index,
+			Filename: sheet.Filename,
+			URL:      r.sheetURL(sheet),
+			Width:    b.Dx(),
+			Height:   b.Dy(),
+		})
+	}
+
+	for _, icon := range r.Icons {
+		box := icon.Rect.Inset(-r.opts.Inset)
+		data.Icons = append(data.Icons, TemplateIcon{
+			Name:               icon.Name,
+			Base:               iconKey(icon.Name),
+			Class:              icon.ClassName(),
+			Sheet:              icon.Sheet,
+			X:                  box.Min.X,
+			Y:                  box.Min.Y,
+			Width:              box.Dx(),
+			Height:             box.Dy(),
+			BackgroundPosition: r.backgroundPosition(box, r.Sheets[icon.Sheet].Image.Bounds()),
+			Aliases:            icon.Aliases,
+		})
+	}
+
+	return data
+}
+
+func (r *Result) executeTemplate(tpl *template.Template) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, r.TemplateData()); err != nil {
+		return nil, fmt.Errorf("%s template: %v", tpl.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// stylesheet renders Options.CSSTemplate, or CSS without one.
+func (r *Result) stylesheet() ([]byte, error) {
+	if r.cssTpl == nil {
+		return []byte(r.CSS()), nil
+	}
+	return r.executeTemplate(r.cssTpl)
+}
+
+// demoPage renders Options.HTMLTemplate, or DemoHTML without one.
+func (r *Result) demoPage() ([]byte, error) {
+	if r.htmlTpl == nil {
+		return r.DemoHTML(), nil
+	}
+	return r.executeTemplate(r.htmlTpl)
+}
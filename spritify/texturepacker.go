@@ -0,0 +1,110 @@
+package spritify
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+type tpRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type tpSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type tpFrame struct {
+	Filename         string `json:"filename,omitempty"`
+	Frame            tpRect `json:"frame"`
+	Rotated          bool   `json:"rotated"`
+	Trimmed          bool   `json:"trimmed"`
+	SpriteSourceSize tpRect `json:"spriteSourceSize"`
+	SourceSize       tpSize `json:"sourceSize"`
+}
+
+type tpMeta struct {
+	App               string   `json:"app"`
+	Version           string   `json:"version"`
+	Image             string   `json:"image"`
+	Format            string   `json:"format"`
+	Size              tpSize   `json:"size"`
+	Scale             string   `json:"scale"`
+	RelatedMultiPacks []string `json:"related_multi_packs,omitempty"`
+}
+
+func newTPFrame(icon *Icon) tpFrame {
+	return tpFrame{
+		Frame:            tpRect{icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy()},
+		Trimmed:          icon.Rect.Size() != icon.SourceSize,
+		SpriteSourceSize: tpRect{icon.TrimOffset.X, icon.TrimOffset.Y, icon.Rect.Dx(), icon.Rect.Dy()},
+		SourceSize:       tpSize{icon.SourceSize.X, icon.SourceSize.Y},
+	}
+}
+
+// texturePacker renders one TexturePacker JSON file per sheet, using the
+// "JSON (Hash)" or "JSON (Array)" frames layout.
+func (r *Result) texturePacker(array bool) ([]File, error) {
+	suffix := ".texturepacker-hash.json"
+	if array {
+		suffix = ".texturepacker-array.json"
+	}
+
+	names := make([]string, len(r.Sheets))
+	for idx, sheet := range r.Sheets {
+		names[idx] = strings.TrimSuffix(sheet.Filename, filepath.Ext(sheet.Filename)) + suffix
+	}
+
+	files := make([]File, 0, len(r.Sheets))
+	for idx, sheet := range r.Sheets {
+		b := sheet.Image.Bounds()
+		meta := tpMeta{
+			App:     "gospritifulcss",
+			Version: "1.0",
+			Image:   sheet.Filename,
+			Format:  "RGBA8888",
+			Size:    tpSize{b.Dx(), b.Dy()},
+			Scale:   "1",
+		}
+		for other, name := range names {
+			if other != idx {
+				meta.RelatedMultiPacks = append(meta.RelatedMultiPacks, name)
+			}
+		}
+
+		var doc interface{}
+		if array {
+			frames := make([]tpFrame, 0, len(sheet.Icons))
+			for _, icon := range sheet.Icons {
+				frame := newTPFrame(icon)
+				frame.Filename = icon.Name
+				frames = append(frames, frame)
+			}
+			doc = struct {
+				Frames []tpFrame `json:"frames"`
+				Meta   tpMeta    `json:"meta"`
+			}{frames, meta}
+		} else {
+			frames := make(map[string]tpFrame, len(sheet.Icons))
+			for _, icon := range sheet.Icons {
+				frames[icon.Name] = newTPFrame(icon)
+			}
+			doc = struct {
+				Frames map[string]tpFrame `json:"frames"`
+				Meta   tpMeta             `json:"meta"`
+			}{frames, meta}
+		}
+
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{names[idx], append(data, '\n')})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,87 @@
+package spritify
+
+import (
+	"image"
+	"sync"
+)
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// trimIcons crops the transparent border of every icon using a pool of jobs
+// workers. Each worker writes only to the icon it was handed. Pixels with an
+// alpha at or below threshold count as transparent.
+func trimIcons(icons []*Icon, jobs int, threshold uint8) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	queue := make(chan *Icon)
+	var workers sync.WaitGroup
+
+	for n := 0; n < jobs; n++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for icon := range queue {
+				trimIcon(icon, threshold)
+			}
+		}()
+	}
+
+	for _, icon := range icons {
+		queue <- icon
+	}
+	close(queue)
+
+	workers.Wait()
+}
+
+func trimIcon(icon *Icon, threshold uint8) {
+	if icon.Frames != nil {
+		// cropping a strip would cut its frames unevenly
+		return
+	}
+	sub, ok := icon.Source.(subImager)
+	if !ok {
+		return
+	}
+
+	orig := icon.Source.Bounds()
+	content := opaqueBounds(icon.Source, threshold)
+	if content.Empty() || content == orig {
+		return
+	}
+
+	icon.Source = sub.SubImage(content)
+	icon.TrimOffset = content.Min.Sub(orig.Min)
+}
+
+// opaqueBounds returns the smallest rectangle holding every pixel whose
+// alpha is above threshold.
+func opaqueBounds(img image.Image, threshold uint8) image.Rectangle {
+	b := img.Bounds()
+	content := image.Rectangle{}
+
+	alphaAt := func(x, y int) uint8 {
+		_, _, _, a := img.At(x, y).RGBA()
+		return uint8(a >> 8)
+	}
+	switch m := img.(type) {
+	case *image.NRGBA:
+		alphaAt = func(x, y int) uint8 { return m.Pix[m.PixOffset(x, y)+3] }
+	case *image.RGBA:
+		alphaAt = func(x, y int) uint8 { return m.Pix[m.PixOffset(x, y)+3] }
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if alphaAt(x, y) > threshold {
+				content = content.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return content
+}
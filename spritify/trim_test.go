@@ -0,0 +1,98 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+// haloIcon is 12x12 at origin with a one pixel border of alpha threshold,
+// one faint pixel of alpha threshold+1 at 2,1 and an opaque 4x4 core at
+// 4,4.
+func haloIcon(origin image.Point, threshold uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rectangle{Max: image.Pt(12, 12)}.Add(origin))
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 12; x++ {
+			if x == 0 || y == 0 || x == 11 || y == 11 {
+				img.SetNRGBA(origin.X+x, origin.Y+y, color.NRGBA{0xff, 0xff, 0xff, threshold})
+			}
+		}
+	}
+	img.SetNRGBA(origin.X+2, origin.Y+1, color.NRGBA{0xff, 0, 0, threshold + 1})
+	draw.Draw(img, image.Rect(4, 4, 8, 8).Add(origin), image.NewUniform(color.Black), image.ZP, draw.Src)
+	return img
+}
+
+func TestOpaqueBoundsThreshold(t *testing.T) {
+	const threshold = 16
+	origin := image.Pt(3, 5)
+	img := haloIcon(origin, threshold)
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	nrgba64 := image.NewNRGBA64(img.Bounds())
+	draw.Draw(nrgba64, nrgba64.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	// the border is trimmed, the faint pixel and the core are not
+	want := image.Rect(2, 1, 8, 8).Add(origin)
+	for name, source := range map[string]image.Image{"nrgba": img, "rgba": rgba, "nrgba64": nrgba64} {
+		if got := opaqueBounds(source, threshold); got != want {
+			t.Errorf("%s: opaqueBounds = %v, want %v", name, got, want)
+		}
+	}
+
+	// one above the faint pixel leaves only the core
+	if got, want := opaqueBounds(img, threshold+1), image.Rect(4, 4, 8, 8).Add(origin); got != want {
+		t.Errorf("threshold %d: opaqueBounds = %v, want %v", threshold+1, got, want)
+	}
+	// at zero only fully transparent pixels go, so nothing is trimmed
+	if got := opaqueBounds(img, 0); got != img.Bounds() {
+		t.Errorf("threshold 0: opaqueBounds = %v, want %v", got, img.Bounds())
+	}
+}
+
+func TestTrimIconOffset(t *testing.T) {
+	icon := &Icon{Source: haloIcon(image.ZP, 16)}
+	trimIcon(icon, 16)
+	if got := icon.Source.Bounds(); got != image.Rect(2, 1, 8, 8) {
+		t.Errorf("trimmed to %v, want %v", got, image.Rect(2, 1, 8, 8))
+	}
+	if icon.TrimOffset != image.Pt(2, 1) {
+		t.Errorf("TrimOffset = %v, want 2,1", icon.TrimOffset)
+	}
+}
+
+// BenchmarkTrim trims 64 decoded 512x512 pngs, each with a transparent
+// border of its own width, at several Jobs values.
+func BenchmarkTrim(b *testing.B) {
+	sources := make([]image.Image, 64)
+	for idx := range sources {
+		border := 8 + idx%32
+		img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+		draw.Draw(img, image.Rect(border, border, 512-border, 512-border), image.NewUniform(color.NRGBA{uint8(idx), 0x80, 0xff, 0xff}), image.ZP, draw.Src)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			b.Fatal(err)
+		}
+		decoded, err := png.Decode(&buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		sources[idx] = decoded
+	}
+
+	for _, jobs := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			icons := make([]*Icon, len(sources))
+			for n := 0; n < b.N; n++ {
+				for idx, source := range sources {
+					icons[idx] = &Icon{Source: source}
+				}
+				trimIcons(icons, jobs, 0)
+			}
+		})
+	}
+}
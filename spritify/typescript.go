@@ -0,0 +1,97 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// moduleNames names every icon of r for the script outputs: its name
+// without extension, "save" or "ui/close", unless another icon has the same
+// one, as save.png and save.svg do, which then both keep their extension.
+func (r *Result) moduleNames() []string {
+	count := make(map[string]int, len(r.Icons))
+	for _, icon := range r.Icons {
+		count[iconKey(icon.Name)]++
+	}
+
+	names := make([]string, len(r.Icons))
+	for idx, icon := range r.Icons {
+		names[idx] = iconKey(icon.Name)
+		if count[names[idx]] > 1 {
+			names[idx] = icon.Name
+		}
+	}
+	return names
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// jsUnion joins strings into a TypeScript union of string literals.
+func jsUnion(strs []string) string {
+	if len(strs) == 0 {
+		return "never"
+	}
+	quoted := make([]string, len(strs))
+	for idx, s := range strs {
+		quoted[idx] = jsString(s)
+	}
+	return strings.Join(quoted, " | ")
+}
+
+// sheetURLs lists the url of every sheet, index for index.
+func (r *Result) sheetURLs() []string {
+	urls := make([]string, len(r.Sheets))
+	for idx, sheet := range r.Sheets {
+		urls[idx] = jsString(r.sheetURL(sheet))
+	}
+	return urls
+}
+
+// TypeScript renders <name>.js, an ES module exporting the sheet urls and
+// every icon's placement by name, and <name>.d.ts typing it, so references
+// to icon names and classes are checked at compile time.
+func (r *Result) TypeScript() []File {
+	names := r.moduleNames()
+
+	var js bytes.Buffer
+	fmt.Fprintf(&js, "export const sheets = [%s];\n\n", strings.Join(r.sheetURLs(), ", "))
+	js.WriteString("export const icons = {\n")
+	for idx, icon := range r.Icons {
+		fmt.Fprintf(&js, "  %s: { x: %d, y: %d, width: %d, height: %d, sheet: %d, className: %s },\n",
+			jsString(names[idx]), icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy(), icon.Sheet, jsString(icon.ClassName()))
+	}
+	js.WriteString("};\n")
+
+	classes := make([]string, len(r.Icons))
+	for idx, icon := range r.Icons {
+		classes[idx] = icon.ClassName()
+	}
+
+	var dts bytes.Buffer
+	fmt.Fprintf(&dts, "export type IconName = %s;\n\n", jsUnion(names))
+	fmt.Fprintf(&dts, "export type IconClass = %s;\n\n", jsUnion(classes))
+	dts.WriteString(`export interface IconRect {
+  x: number;
+  y: number;
+  width: number;
+  height: number;
+  sheet: number; // index into sheets
+  className: IconClass;
+}
+
+export declare const sheets: readonly string[];
+
+export declare const icons: { readonly [name in IconName]: IconRect };
+`)
+
+	return []File{
+		{r.opts.Name + ".js", js.Bytes()},
+		{r.opts.Name + ".d.ts", dts.Bytes()},
+	}
+}
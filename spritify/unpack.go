@@ -0,0 +1,178 @@
+package spritify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Region is one image packed on a sheet, as a manifest describes it.
+type Region struct {
+	Name  string          // relative slash separated path of the source, e.g. "ui/save.png"
+	Sheet string          // sheet file the region is on, empty when unknown
+	Rect  image.Rectangle // where the pixels are on the sheet
+
+	// Rotated regions are stored turned 90° clockwise, as TexturePacker
+	// does, and are turned back when unpacked.
+	Rotated bool
+
+	// Offset and SourceSize restore trimmed transparent borders: the
+	// pixels are put at Offset on a transparent SourceSize canvas. A zero
+	// SourceSize keeps the region as it is.
+	Offset     image.Point
+	SourceSize image.Point
+}
+
+// ParseManifest reads the regions from a manifest written by this package
+// (<name>.json), a TexturePacker hash or array JSON, or a stylesheet with
+// one background-position rule per class. sheet is the size of the packed
+// image, which rules anchored at the right or bottom are relative to.
+func ParseManifest(data []byte, sheet image.Point) ([]Region, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return parseCSSRegions(string(data), sheet)
+	}
+
+	var doc struct {
+		Sheet  *manifestSheet         `json:"sheet"`
+		Sheets []manifestSheet        `json:"sheets"`
+		Icons  []manifestIcon         `json:"icons"`
+		Frames json.RawMessage        `json:"frames"`
+		Meta   struct{ Image string } `json:"meta"`
+	}
+	if err := json.Unmarshal(trimmed, &doc); err != nil {
+		return nil, fmt.Errorf("manifest: %v", err)
+	}
+
+	switch {
+	case doc.Icons != nil:
+		if doc.Sheet != nil {
+			doc.Sheets = []manifestSheet{*doc.Sheet}
+		}
+		regions := make([]Region, 0, len(doc.Icons))
+		for _, icon := range doc.Icons {
+			if icon.Sheet < 0 || icon.Sheet >= len(doc.Sheets) {
+				return nil, fmt.Errorf("manifest: %s is on sheet %d, which is not listed", icon.Name, icon.Sheet)
+			}
+			regions = append(regions, Region{
+				Name:  icon.Name,
+				Sheet: doc.Sheets[icon.Sheet].Image,
+				Rect:  image.Rect(icon.X, icon.Y, icon.X+icon.Width, icon.Y+icon.Height),
+			})
+		}
+		return regions, nil
+	case len(doc.Frames) > 0:
+		return parseTPFrames(doc.Frames, doc.Meta.Image)
+	}
+
+	return nil, fmt.Errorf("manifest: neither icons nor frames found")
+}
+
+func parseTPFrames(raw json.RawMessage, sheet string) ([]Region, error) {
+	var frames []tpFrame
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &frames); err != nil {
+			return nil, fmt.Errorf("manifest: %v", err)
+		}
+	} else {
+		hash := make(map[string]tpFrame)
+		if err := json.Unmarshal(raw, &hash); err != nil {
+			return nil, fmt.Errorf("manifest: %v", err)
+		}
+		for name, frame := range hash {
+			frame.Filename = name
+			frames = append(frames, frame)
+		}
+		sort.Slice(frames, func(i, j int) bool { return frames[i].Filename < frames[j].Filename })
+	}
+
+	regions := make([]Region, 0, len(frames))
+	for _, frame := range frames {
+		f := frame.Frame
+		w, h := f.W, f.H
+		if frame.Rotated {
+			w, h = h, w
+		}
+
+		region := Region{
+			Name:    frame.Filename,
+			Sheet:   sheet,
+			Rect:    image.Rect(f.X, f.Y, f.X+w, f.Y+h),
+			Rotated: frame.Rotated,
+		}
+		if frame.Trimmed {
+			region.Offset = image.Pt(frame.SpriteSourceSize.X, frame.SpriteSourceSize.Y)
+			region.SourceSize = image.Pt(frame.SourceSize.W, frame.SourceSize.H)
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// Unpack cuts every region out of sheet and encodes it as a png named after
+// the region, e.g. "ui/save.jpg" becomes "ui/save.png". Names that are
+// absolute or climb out with ".." are rejected.
+func Unpack(sheet image.Image, regions []Region) ([]File, error) {
+	bounds := sheet.Bounds()
+	seen := make(map[string]bool)
+	files := make([]File, 0, len(regions))
+
+	for _, region := range regions {
+		rect := region.Rect.Add(bounds.Min)
+		if region.Rect.Empty() || !rect.In(bounds) {
+			return nil, fmt.Errorf("%s: region %v is outside the %dx%d sheet", region.Name, region.Rect, bounds.Dx(), bounds.Dy())
+		}
+
+		name := strings.Replace(region.Name, `\`, "/", -1)
+		if path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+			return nil, fmt.Errorf("%s: absolute paths are not unpacked", region.Name)
+		}
+		for _, elem := range strings.Split(name, "/") {
+			if elem == ".." {
+				return nil, fmt.Errorf("%s: paths leaving the output directory are not unpacked", region.Name)
+			}
+		}
+		name = path.Clean(name)
+		filename := strings.TrimSuffix(name, path.Ext(name)) + ".png"
+		if seen[filename] {
+			return nil, fmt.Errorf("%s: more than one region would be written to %s", region.Name, filename)
+		}
+		seen[filename] = true
+
+		img := image.NewNRGBA(image.Rectangle{Max: rect.Size()})
+		draw.Draw(img, img.Bounds(), sheet, rect.Min, draw.Src)
+		if region.Rotated {
+			img = rotateCCW(img)
+		}
+		if region.SourceSize != image.ZP {
+			canvas := image.NewNRGBA(image.Rectangle{Max: region.SourceSize})
+			draw.Draw(canvas, img.Bounds().Add(region.Offset), img, image.ZP, draw.Src)
+			img = canvas
+		}
+
+		var buf bytes.Buffer
+		if err := encodeStrippedPNG(&buf, img); err != nil {
+			return nil, err
+		}
+		files = append(files, File{filename, buf.Bytes()})
+	}
+
+	return files, nil
+}
+
+// rotateCCW turns img 90° counterclockwise, undoing a clockwise rotation.
+func rotateCCW(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	rotated := image.NewNRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			rotated.Set(y, b.Dx()-1-x, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return rotated
+}
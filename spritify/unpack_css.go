@@ -0,0 +1,239 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	cssComment   = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssClassOnly = regexp.MustCompile(`^\.(-?[_\pL][-_\pL\pN]*)$`)
+	cssURL       = regexp.MustCompile(`url\(\s*["']?([^"')]*)["']?\s*\)`)
+)
+
+// cssRule keeps the declarations unpacking cares about.
+type cssRule struct {
+	selectors []string
+	position  string
+	width     string
+	height    string
+	image     string
+}
+
+// parseCSSRegions makes one region per class selector with a
+// background-position. Width and height come from the rule itself or from
+// a rule without position, like the shared .icon rule. At-rules such as the
+// retina media query are skipped.
+func parseCSSRegions(css string, sheet image.Point) ([]Region, error) {
+	rules := parseCSSRules(cssComment.ReplaceAllString(css, ""))
+
+	var shared cssRule
+	for _, rule := range rules {
+		if rule.position == "" {
+			if rule.width != "" {
+				shared.width = rule.width
+			}
+			if rule.height != "" {
+				shared.height = rule.height
+			}
+			if rule.image != "" {
+				shared.image = rule.image
+			}
+		}
+	}
+
+	var regions []Region
+	for _, rule := range rules {
+		if rule.position == "" {
+			continue
+		}
+		for _, selector := range rule.selectors {
+			class := cssClassOnly.FindStringSubmatch(selector)
+			if class == nil {
+				continue
+			}
+
+			region, err := cssRegion(rule, shared, sheet)
+			if err != nil {
+				return nil, fmt.Errorf("css: .%s: %v", class[1], err)
+			}
+			region.Name = class[1] + ".png"
+			regions = append(regions, region)
+		}
+	}
+
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("css: no class rules with a background-position found")
+	}
+	return regions, nil
+}
+
+func parseCSSRules(css string) []cssRule {
+	var rules []cssRule
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			return rules
+		}
+		prelude := strings.TrimSpace(css[:open])
+
+		if strings.HasPrefix(prelude, "@") {
+			css = css[open+skipCSSBlock(css[open:]):]
+			continue
+		}
+
+		end := strings.Index(css[open:], "}")
+		if end < 0 {
+			end = len(css) - open
+		}
+		body := css[open+1 : open+end]
+		if open+end+1 < len(css) {
+			css = css[open+end+1:]
+		} else {
+			css = ""
+		}
+
+		rule := cssRule{}
+		for _, selector := range strings.Split(prelude, ",") {
+			rule.selectors = append(rule.selectors, strings.TrimSpace(selector))
+		}
+		for _, decl := range strings.Split(body, ";") {
+			colon := strings.Index(decl, ":")
+			if colon < 0 {
+				continue
+			}
+			prop := strings.ToLower(strings.TrimSpace(decl[:colon]))
+			value := strings.TrimSpace(decl[colon+1:])
+
+			switch prop {
+			case "width":
+				rule.width = value
+			case "height":
+				rule.height = value
+			case "background-position":
+				rule.position = value
+			case "background-image":
+				rule.image = cssImage(value)
+			case "background":
+				rule.image = cssImage(value)
+				position := cssURL.ReplaceAllString(value, "")
+				if _, _, _, _, err := cssPosition(position); err == nil {
+					rule.position = position
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+}
+
+// skipCSSBlock returns the length of the balanced {...} block css starts
+// with.
+func skipCSSBlock(css string) int {
+	depth := 0
+	for i, r := range css {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+func cssImage(value string) string {
+	if url := cssURL.FindStringSubmatch(value); url != nil {
+		return path.Base(url[1])
+	}
+	return ""
+}
+
+func cssRegion(rule cssRule, shared cssRule, sheet image.Point) (Region, error) {
+	width, height := rule.width, rule.height
+	if width == "" {
+		width = shared.width
+	}
+	if height == "" {
+		height = shared.height
+	}
+	w, err := cssPixels(width)
+	if err != nil {
+		return Region{}, fmt.Errorf("width: %v", err)
+	}
+	h, err := cssPixels(height)
+	if err != nil {
+		return Region{}, fmt.Errorf("height: %v", err)
+	}
+
+	x, y, fromRight, fromBottom, err := cssPosition(rule.position)
+	if err != nil {
+		return Region{}, err
+	}
+
+	// a left/top offset moves the sheet by -x, a right/bottom one by x
+	// from the far edge; see backgroundPosition
+	min := image.Pt(-x, -y)
+	if fromRight {
+		min.X = sheet.X + x - w
+	}
+	if fromBottom {
+		min.Y = sheet.Y + y - h
+	}
+
+	sheetFile := rule.image
+	if sheetFile == "" {
+		sheetFile = shared.image
+	}
+	return Region{Sheet: sheetFile, Rect: image.Rectangle{Min: min, Max: min.Add(image.Pt(w, h))}}, nil
+}
+
+// cssPosition reads "Xpx Ypx", "left Xpx top Ypx" or "right Xpx bottom Ypx"
+// background positions, also inside a background shorthand.
+func cssPosition(value string) (x, y int, fromRight, fromBottom bool, err error) {
+	var offsets []int
+	for _, field := range strings.Fields(value) {
+		switch strings.ToLower(field) {
+		case "right":
+			fromRight = true
+			continue
+		case "bottom":
+			fromBottom = true
+			continue
+		}
+		// other keywords and colors of a background shorthand
+		if !strings.ContainsAny(field[:1], "-+.0123456789") {
+			continue
+		}
+
+		px, perr := cssPixels(field)
+		if perr != nil {
+			return 0, 0, false, false, fmt.Errorf("background-position %q: %v", value, perr)
+		}
+		offsets = append(offsets, px)
+	}
+
+	if len(offsets) != 2 {
+		return 0, 0, false, false, fmt.Errorf("background-position %q: expected two pixel offsets", value)
+	}
+	return offsets[0], offsets[1], fromRight, fromBottom, nil
+}
+
+func cssPixels(value string) (int, error) {
+	if value == "" {
+		return 0, fmt.Errorf("not declared")
+	}
+	if value == "0" {
+		return 0, nil
+	}
+	if !strings.HasSuffix(value, "px") {
+		return 0, fmt.Errorf("%q is not in px", value)
+	}
+	return strconv.Atoi(strings.TrimSuffix(value, "px"))
+}
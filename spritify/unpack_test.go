@@ -0,0 +1,47 @@
+package spritify
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnpackKeepsDirectories(t *testing.T) {
+	sheet := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	files, err := Unpack(sheet, []Region{
+		{Name: "ui/save.png", Rect: image.Rect(0, 0, 4, 4)},
+		{Name: `ui\forms\close.jpg`, Rect: image.Rect(4, 0, 8, 4)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "ui/save.png" || files[1].Name != "ui/forms/close.png" {
+		t.Fatalf("unpacked %v, want ui/save.png and ui/forms/close.png", fileNames(files))
+	}
+
+	dir := t.TempDir()
+	if err := WriteFiles(dir, files); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ui", "forms", "close.png")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnpackRejectsEscapingNames(t *testing.T) {
+	sheet := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for _, name := range []string{"../save.png", "ui/../../save.png", `..\save.png`, "/etc/save.png", `C:\save.png`} {
+		if _, err := Unpack(sheet, []Region{{Name: name, Rect: image.Rect(0, 0, 4, 4)}}); err == nil {
+			t.Errorf("Unpack accepted %q", name)
+		}
+	}
+}
+
+func fileNames(files []File) []string {
+	names := make([]string, len(files))
+	for idx, f := range files {
+		names[idx] = f.Name
+	}
+	return names
+}
@@ -0,0 +1,118 @@
+package spritify
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Variant derives an extra version of every icon, packed as
+// "<name>--<Variant.Name>.<ext>" so it gets a class of its own.
+type Variant struct {
+	Name      string  // suffix of the derived file name, e.g. "disabled"
+	Grayscale bool    // drop the colors, keeping their luminance
+	Opacity   float64 // scale the alpha by this factor, 1 keeps it
+}
+
+// ParseVariant reads a variant spec: operations joined by "+", grayscale
+// or dim<percent of opacity kept>, optionally named with a "<name>=" prefix,
+// e.g. "grayscale", "dim50" or "disabled=grayscale+dim50". Unnamed variants
+// are named after their spec, with "-" for "+".
+func ParseVariant(spec string) (Variant, error) {
+	v := Variant{Name: strings.Replace(spec, "+", "-", -1), Opacity: 1}
+	ops := spec
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		v.Name, ops = spec[:idx], spec[idx+1:]
+	}
+	if v.Name == "" || !cssIdent.MatchString("x"+v.Name) {
+		return Variant{}, fmt.Errorf("invalid variant name %q", v.Name)
+	}
+
+	for _, op := range strings.Split(ops, "+") {
+		switch {
+		case op == "grayscale":
+			v.Grayscale = true
+		case strings.HasPrefix(op, "dim"):
+			percent, err := strconv.Atoi(strings.TrimPrefix(op, "dim"))
+			if err != nil || percent < 0 || percent > 100 {
+				return Variant{}, fmt.Errorf("invalid variant %q, dim takes the percent of opacity to keep, e.g. dim50", spec)
+			}
+			v.Opacity *= float64(percent) / 100
+		default:
+			return Variant{}, fmt.Errorf("invalid variant %q, expected grayscale or dim<percent> joined by +", spec)
+		}
+	}
+	return v, nil
+}
+
+// apply renders img with the variant's operations.
+func (v Variant) apply(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(b)
+	draw.Draw(nrgba, b, img, b.Min, draw.Src)
+
+	for idx := 0; idx < len(nrgba.Pix); idx += 4 {
+		px := nrgba.Pix[idx : idx+4 : idx+4]
+		if v.Grayscale {
+			y := color.GrayModel.Convert(color.RGBA{px[0], px[1], px[2], 0xff}).(color.Gray).Y
+			px[0], px[1], px[2] = y, y, y
+		}
+		px[3] = uint8(float64(px[3])*v.Opacity + 0.5)
+	}
+	return nrgba
+}
+
+// addVariants packs every variant of every icon, unless a source file of
+// the variant's name already exists, which is used as it is.
+func (g *Generator) addVariants() {
+	names := make(map[string]bool, len(g.icons))
+	for _, icon := range g.icons {
+		names[icon.Name] = true
+	}
+
+	derived := func(icon *Icon) bool {
+		if stateName.MatchString(iconKey(icon.Name)) {
+			return true
+		}
+		for _, v := range g.opts.Variants {
+			if strings.HasSuffix(iconKey(icon.Name), "--"+v.Name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// every variant goes right after its source, so the name order of the
+	// sources is kept and the ordered layouts pack them side by side
+	icons := make([]*Icon, 0, len(g.icons)*(1+len(g.opts.Variants)))
+	for _, icon := range g.icons {
+		icons = append(icons, icon)
+		if derived(icon) {
+			// states and exported variants are not varied again
+			continue
+		}
+
+		for _, v := range g.opts.Variants {
+			name := iconKey(icon.Name) + "--" + v.Name + filepath.Ext(icon.Name)
+			if names[name] {
+				continue
+			}
+			names[name] = true
+
+			variant := &Icon{Name: name, SourceSize: icon.SourceSize, Frames: icon.Frames, path: icon.path}
+			variant.Source = v.apply(icon.Source)
+			if icon.Retina != nil {
+				variant.Retina = v.apply(icon.Retina)
+			}
+			if icon.dense != nil {
+				variant.dense = v.apply(icon.dense)
+			}
+			icons = append(icons, variant)
+		}
+	}
+	g.icons = icons
+}
@@ -0,0 +1,74 @@
+package spritify
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var customElementName = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// ElementName is the custom element WebComponent defines, <name>-icon for a
+// Name that makes a valid one and sprite-icon otherwise.
+func (r *Result) ElementName() string {
+	name := strings.ToLower(r.opts.Name)
+	if !customElementName.MatchString(name) {
+		name = "sprite"
+	}
+	return name + "-icon"
+}
+
+// WebComponent renders <name>-icon.js, a script defining the custom element
+// ElementName, so <sprite-icon name="save"></sprite-icon> shows an icon
+// without any framework. Like React it carries the placements and refers
+// to the sheets by url, or inlines them with Embed.
+func (r *Result) WebComponent() File {
+	names := r.moduleNames()
+
+	var buf bytes.Buffer
+	buf.WriteString("(() => {\n")
+	fmt.Fprintf(&buf, "  const sheets = [%s];\n\n", strings.Join(r.sheetURLs(), ", "))
+	buf.WriteString("  // x, y, width, height and index into sheets\n")
+	buf.WriteString("  const icons = {\n")
+	for idx, icon := range r.Icons {
+		fmt.Fprintf(&buf, "    %s: [%d, %d, %d, %d, %d],\n", jsString(names[idx]), icon.Rect.Min.X, icon.Rect.Min.Y, icon.Rect.Dx(), icon.Rect.Dy(), icon.Sheet)
+	}
+	buf.WriteString("  };\n\n")
+
+	buf.WriteString(`  class SpriteIcon extends HTMLElement {
+    static get observedAttributes() {
+      return ["name"];
+    }
+
+    connectedCallback() {
+      this.render();
+    }
+
+    attributeChangedCallback() {
+      this.render();
+    }
+
+    render() {
+      const name = this.getAttribute("name");
+      if (!Object.prototype.hasOwnProperty.call(icons, name)) {
+        this.style.display = "none";
+        return;
+      }
+      const [x, y, width, height, sheet] = icons[name];
+      Object.assign(this.style, {
+        display: "inline-block",
+        width: ` + "`${width}px`" + `,
+        height: ` + "`${height}px`" + `,
+        background: ` + "`url(\"${sheets[sheet]}\") no-repeat ${-x}px ${-y}px`" + `,
+      });
+    }
+  }
+
+`)
+	fmt.Fprintf(&buf, "  if (!customElements.get(%s)) {\n", jsString(r.ElementName()))
+	fmt.Fprintf(&buf, "    customElements.define(%s, SpriteIcon);\n", jsString(r.ElementName()))
+	buf.WriteString("  }\n})();\n")
+
+	return File{r.ElementName() + ".js", buf.Bytes()}
+}
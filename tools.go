@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+// toolEncoders encode output formats the standard library has no encoder
+// for by handing a temporary png to the usual command line tool.
+var toolEncoders = map[string]struct {
+	tool string
+	args func(in, out string) []string
+}{
+	"webp": {"cwebp", func(in, out string) []string { return []string{"-quiet", in, "-o", out} }},
+	"avif": {"avifenc", func(in, out string) []string { return []string{in, out} }},
+}
+
+// registerOutputFormat makes -output-format=format usable, exiting when it
+// needs a tool that is not installed.
+func registerOutputFormat(format string) {
+	enc, ok := toolEncoders[format]
+	if !ok {
+		// png, or unknown and reported by spritify
+		return
+	}
+
+	tool, err := exec.LookPath(enc.tool)
+	if err != nil {
+		logger.Error(fmt.Sprintf("-output-format=%s needs %s in PATH", format, enc.tool))
+		os.Exit(-1)
+	}
+
+	spritify.RegisterEncoder(format, func(w io.Writer, img image.Image) error {
+		dir, err := os.MkdirTemp("", "gospritifulcss")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		in := filepath.Join(dir, "sheet.png")
+		out := filepath.Join(dir, "sheet."+format)
+
+		handler, err := os.Create(in)
+		if err != nil {
+			return err
+		}
+		err = png.Encode(handler, img)
+		if cerr := handler.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+
+		if output, err := exec.Command(tool, enc.args(in, out)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", enc.tool, err, output)
+		}
+
+		data, err := os.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// optimizer runs command on every encoded sheet. The sheet is piped to its
+// stdin and replaced by its stdout, unless the command mentions {}: then {}
+// is a temporary copy of the sheet that the command rewrites in place, as
+// `oxipng -o 4 {}` or `zopflipng -y {} {}` do.
+func optimizer(command string) func(data []byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = &stderr
+
+		var tmp string
+		if strings.Contains(command, "{}") {
+			dir, err := os.MkdirTemp("", "gospritifulcss")
+			if err != nil {
+				return nil, err
+			}
+			defer os.RemoveAll(dir)
+
+			tmp = filepath.Join(dir, "sheet")
+			if err := os.WriteFile(tmp, data, 0666); err != nil {
+				return nil, err
+			}
+			cmd.Args[2] = strings.Replace(command, "{}", shellQuote(tmp), -1)
+		} else {
+			cmd.Stdin = bytes.NewReader(data)
+			cmd.Stdout = &stdout
+		}
+
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("optimize-cmd: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if tmp != "" {
+			return os.ReadFile(tmp)
+		}
+		if stdout.Len() == 0 {
+			return nil, fmt.Errorf("optimize-cmd: no output, the sheet is expected on stdout")
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+// svgDecoder rasterizes svg sources with rsvg-convert at scale times their
+// intrinsic size, exiting when rsvg-convert is not installed. It is handed
+// to a single target through Options.ExtDecoders, so every target keeps
+// its own -svg-scale.
+func svgDecoder(scale float64) spritify.Decoder {
+	tool, err := exec.LookPath("rsvg-convert")
+	if err != nil {
+		logger.Error("svg sources need rsvg-convert in PATH")
+		os.Exit(-1)
+	}
+
+	return func(r io.Reader) (image.Image, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(tool, "--format=png", "--zoom="+strconv.FormatFloat(scale, 'g', -1, 64))
+		cmd.Stdin = r
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("rsvg-convert: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return png.Decode(&stdout)
+	}
+}
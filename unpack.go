@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/kylidboy/gospritifulcss/spritify"
+)
+
+func runUnpack(args []string) {
+	flags := flag.NewFlagSet("unpack", flag.ExitOnError)
+	outDir := flags.String("out", "./", "directory the images are written to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gospritifulcss unpack [-out dir] <sprite> <manifest.json|.css>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	files, err := unpack(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(-1)
+	}
+
+	absOut, err := outputDir(*outDir)
+	if err == nil {
+		err = spritify.WriteFiles(absOut, files)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(-1)
+	}
+	logger.Info(fmt.Sprintf("unpacked %d images into %s", len(files), absOut))
+}
+
+// unpack cuts the regions the manifest places on spritePath out of it.
+// When the manifest covers several sheets, only the regions on the sheet
+// named like spritePath are taken.
+func unpack(spritePath string, manifestPath string) ([]spritify.File, error) {
+	handler, err := os.Open(spritePath)
+	if err != nil {
+		return nil, err
+	}
+	defer handler.Close()
+
+	sheet, _, err := image.Decode(handler)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spritePath, err)
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := spritify.ParseManifest(data, sheet.Bounds().Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", manifestPath, err)
+	}
+
+	sheets := make(map[string]bool)
+	for _, region := range regions {
+		if region.Sheet != "" {
+			sheets[region.Sheet] = true
+		}
+	}
+	if len(sheets) > 1 {
+		filename := filepath.Base(spritePath)
+		onSheet := regions[:0]
+		for _, region := range regions {
+			if region.Sheet == filename {
+				onSheet = append(onSheet, region)
+			}
+		}
+		if len(onSheet) == 0 {
+			return nil, fmt.Errorf("%s lists no images on %s", manifestPath, filename)
+		}
+		regions = onSheet
+	}
+
+	return spritify.Unpack(sheet, regions)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot records size and modification time of every entry in dir, or
+// with recursive of every file below it outside hidden directories.
+func snapshot(dir string, recursive bool) (map[string]fileState, error) {
+	if recursive {
+		return snapshotTree(dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// removed between ReadDir and Info, the next poll sees it gone
+			continue
+		}
+		state[entry.Name()] = fileState{info.Size(), info.ModTime()}
+	}
+	return state, nil
+}
+
+func snapshotTree(dir string) (map[string]fileState, error) {
+	state := make(map[string]fileState)
+	err := filepath.WalkDir(dir, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if pathname != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed while walking, the next poll sees it gone
+			return nil
+		}
+		state[pathname] = fileState{info.Size(), info.ModTime()}
+		return nil
+	})
+	return state, err
+}
+
+func sameState(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, sa := range a {
+		sb, ok := b[name]
+		if !ok || sa.size != sb.size || !sa.modTime.Equal(sb.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchSrc calls rebuild for a target whenever its source directory
+// changes. It polls rather than subscribing to file system events so it
+// works the same everywhere, including network mounts and containers. Build
+// errors are printed and watching continues; only an unreadable source
+// directory ends it.
+func watchSrc(targets []target, rebuild func(target) error) {
+	last := make([]map[string]fileState, len(targets))
+
+	for {
+		for i, t := range targets {
+			current, err := snapshot(t.opts.Src, t.opts.Recursive)
+			if err != nil {
+				logger.Error(t.errorf(err).Error())
+				os.Exit(-1)
+			}
+
+			if last[i] != nil && sameState(last[i], current) {
+				continue
+			}
+
+			if err := rebuild(t); err != nil {
+				logger.Error(err.Error())
+			} else {
+				logger.Info(fmt.Sprint("rebuilt ", t.opts.Name, " at ", time.Now().Format("15:04:05")))
+			}
+
+			// the outputs may live in the source directory, take the
+			// snapshot after writing them so they don't retrigger a build
+			if last[i], err = snapshot(t.opts.Src, t.opts.Recursive); err != nil {
+				logger.Error(t.errorf(err).Error())
+				os.Exit(-1)
+			}
+		}
+
+		time.Sleep(*watchEvery)
+	}
+}